@@ -9,9 +9,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -23,6 +25,12 @@ var (
 	endpoint         = flag.String("endpoint", "unix:///tmp/csi.sock", "CSI endpoint")
 	cloudstackconfig = flag.String("cloudstackconfig", "./cloud-config", "CloudStack configuration file")
 	nodeName         = flag.String("nodeName", "", "Node name")
+	maxVolumes       = flag.Int64("max-volumes-per-node", 0, "Maximum number of volumes attached to a node (default: determined from the hypervisor)")
+	metricsAddress   = flag.String("metrics-address", "", "Address (host:port) on which to serve Prometheus metrics at /metrics (default: disabled)")
+	healthAddress    = flag.String("health-address", "", "Address (host:port) on which to serve liveness probes at /healthz and readiness probes at /readyz (default: disabled)")
+	healthInterval   = flag.Duration("health-check-interval", 0, "Minimum interval between checks of the CloudStack API by Probe and readiness probes (default: 0, no check)")
+	clusterID        = flag.String("cluster-id", "", "ID of the Kubernetes cluster, set as a resource tag on CloudStack volumes (default: none)")
+	volumeNamePrefix = flag.String("volume-name-prefix", driver.DefaultVolumeNamePrefix, "Name prefix of the volumes created by the external-provisioner (its option --volume-name-prefix), identifying the volumes of the driver when no cluster ID is given")
 	debug            = flag.Bool("debug", false, "Enable debug logging")
 	showVersion      = flag.Bool("version", false, "Show version")
 
@@ -73,14 +81,40 @@ func run() {
 	logger.Sugar().Debugf("Successfully read CloudStack configuration %v", *cloudstackconfig)
 	csConnector := cloud.New(config)
 
-	d, err := driver.New(*endpoint, csConnector, nil, *nodeName, version, logger)
+	d, err := driver.New(*endpoint, csConnector, nil, *nodeName, *maxVolumes, *healthInterval, *clusterID, *volumeNamePrefix, version, logger)
 	if err != nil {
 		logger.Sugar().Errorw("Failed to initialize driver", "error", err)
 		os.Exit(1)
 	}
 
+	// Setup HTTP endpoints, possibly on the same address
+	muxes := make(map[string]*http.ServeMux)
+	handle := func(address, pattern string, handler http.Handler) {
+		if address == "" {
+			return
+		}
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		muxes[address].Handle(pattern, handler)
+	}
+	handle(*metricsAddress, "/metrics", promhttp.Handler())
+	handle(*healthAddress, "/healthz", d.Healthz())
+	handle(*healthAddress, "/readyz", d.Readyz())
+	for address, mux := range muxes {
+		go serveHTTP(address, mux, logger)
+	}
+
 	if err = d.Run(); err != nil {
 		logger.Sugar().Errorw("Server error", "error", err)
 		os.Exit(1)
 	}
 }
+
+func serveHTTP(address string, handler http.Handler, logger *zap.Logger) {
+	logger.Sugar().Infow("Serving HTTP", "address", address)
+	if err := http.ListenAndServe(address, handler); err != nil {
+		logger.Sugar().Errorw("HTTP server error", "address", address, "error", err)
+		os.Exit(1)
+	}
+}
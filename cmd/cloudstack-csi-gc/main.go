@@ -0,0 +1,65 @@
+// Small utility to find, and possibly delete, CloudStack volumes
+// created by the driver which are no longer used by Kubernetes.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/gc"
+)
+
+const agent = "cloudstack-csi-gc"
+
+var (
+	cloudstackconfig = flag.String("cloudstackconfig", "./cloud-config", "CloudStack configuration file")
+	kubeconfig       = flag.String("kubeconfig", path.Join(os.Getenv("HOME"), ".kube/config"), "Kubernetes configuration file. Use \"-\" to use in-cluster configuration.")
+	clusterID        = flag.String("cluster-id", "", "Select the volumes tagged with this cluster ID, as given to the driver (default: select them by name prefix)")
+	namePrefix       = flag.String("namePrefix", "pvc-", "Name prefix of the volumes, when no cluster ID is given")
+	deleteOrphans    = flag.Bool("delete", false, "Delete orphaned volumes older than -min-age, selected by -cluster-id (default: dry run)")
+	minAge           = flag.Duration("min-age", 0, "Minimum age of the orphaned volumes to delete, required with -delete")
+	showVersion      = flag.Bool("version", false, "Show version")
+
+	// Version is set by the build process
+	version = ""
+)
+
+func main() {
+	flag.Parse()
+
+	if *showVersion {
+		baseName := path.Base(os.Args[0])
+		fmt.Println(baseName, version)
+		return
+	}
+
+	c, err := gc.New(gc.Config{
+		Agent:            agent,
+		CloudStackConfig: *cloudstackconfig,
+		KubeConfig:       *kubeconfig,
+		ClusterID:        *clusterID,
+		NamePrefix:       *namePrefix,
+		Delete:           *deleteOrphans,
+		MinAge:           *minAge,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	report, runErr := c.Run(context.Background())
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if runErr != nil {
+		log.Fatalf("Error: %v", runErr)
+	}
+	os.Exit(0)
+}
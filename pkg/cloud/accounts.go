@@ -0,0 +1,85 @@
+package cloud
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/util"
+)
+
+// unlimitedResource is the value given by CloudStack
+// for resources which are not limited.
+const unlimitedResource = "Unlimited"
+
+func (c *client) GetAvailablePrimaryStorage(ctx context.Context) (int64, error) {
+	if c.projectID != "" {
+		return c.getProjectAvailablePrimaryStorage(ctx)
+	}
+
+	slog := ctxzap.Extract(ctx).Sugar()
+
+	p := c.Account.NewListAccountsParams()
+	slog.Infow("CloudStack API call", "command", "ListAccounts", "params", map[string]string{})
+	var l *cloudstack.ListAccountsResponse
+	err := c.retry(ctx, "ListAccounts", func() error {
+		var err error
+		l, err = c.Account.ListAccounts(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if l.Count != 1 {
+		// Accounts of domain administrators may list other accounts:
+		// the account whose credentials are used cannot be determined.
+		slog.Debugf("ListAccounts returned %d accounts: ignoring account limits", l.Count)
+		return UnlimitedCapacity, nil
+	}
+	return parseAvailablePrimaryStorage(l.Accounts[0].Primarystorageavailable)
+}
+
+// getProjectAvailablePrimaryStorage returns the primary storage
+// still available in the resource limits of the configured project.
+func (c *client) getProjectAvailablePrimaryStorage(ctx context.Context) (int64, error) {
+	p := c.Project.NewListProjectsParams()
+	p.SetId(c.projectID)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListProjects", "params", map[string]string{
+		"id": c.projectID,
+	})
+	var l *cloudstack.ListProjectsResponse
+	err := c.retry(ctx, "ListProjects", func() error {
+		var err error
+		l, err = c.Project.ListProjects(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if l.Count == 0 {
+		return 0, ErrNotFound
+	}
+	if l.Count > 1 {
+		return 0, ErrTooManyResults
+	}
+	return parseAvailablePrimaryStorage(l.Projects[0].Primarystorageavailable)
+}
+
+// parseAvailablePrimaryStorage converts the available primary storage
+// of a CloudStack resource limit to bytes.
+func parseAvailablePrimaryStorage(available string) (int64, error) {
+	if available == "" || available == unlimitedResource {
+		return UnlimitedCapacity, nil
+	}
+	// Primary storage limits are given in GB
+	availableGB, err := strconv.ParseInt(available, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if availableGB < 0 {
+		availableGB = 0
+	}
+	return util.GigaBytesToBytes(availableGB), nil
+}
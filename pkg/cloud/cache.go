@@ -0,0 +1,98 @@
+package cloud
+
+import (
+	"sync"
+	"time"
+)
+
+// Names of the caches of lookups, as reported in metrics.
+const (
+	cacheVM    = "vm"
+	cacheNode  = "node"
+	cacheZones = "zones"
+)
+
+// ttlCache is a cache whose entries expire after a fixed duration.
+// A nil *ttlCache is a disabled cache, which never hits.
+type ttlCache struct {
+	name string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// newTTLCache creates a cache, or returns nil if ttl is not positive.
+func newTTLCache(name string, ttl time.Duration) *ttlCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &ttlCache{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		cacheRequests.WithLabelValues(c.name, "hit").Inc()
+		return entry.value, true
+	}
+	if ok {
+		delete(c.entries, key)
+	}
+	cacheRequests.WithLabelValues(c.name, "miss").Inc()
+	return nil, false
+}
+
+func (c *ttlCache) set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// invalidate removes the entries for which match returns true.
+func (c *ttlCache) invalidate(match func(key string, value interface{}) bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if match(key, entry.value) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// invalidateVM removes a VM from the caches of VM lookups.
+func (c *client) invalidateVM(vmID string) {
+	match := func(_ string, value interface{}) bool {
+		return value.(VM).ID == vmID
+	}
+	c.vmCache.invalidate(match)
+	c.nodeCache.invalidate(match)
+}
+
+// invalidateZones removes the cached list of zones.
+func (c *client) invalidateZones() {
+	c.zonesCache.invalidate(func(string, interface{}) bool { return true })
+}
@@ -0,0 +1,113 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTTLCache(t *testing.T) {
+	c := newTTLCache("test", 50*time.Millisecond)
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("test", "hit"))
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("test", "miss"))
+	if _, ok := c.get("a"); ok {
+		t.Error("Unexpected hit in an empty cache")
+	}
+	c.set("a", 1)
+	if v, ok := c.get("a"); !ok || v.(int) != 1 {
+		t.Errorf("Expected a hit with 1, got %v, %v", v, ok)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Error("Unexpected hit of an expired entry")
+	}
+	c.set("b", 2)
+	c.invalidate(func(key string, _ interface{}) bool { return key == "b" })
+	if _, ok := c.get("b"); ok {
+		t.Error("Unexpected hit of an invalidated entry")
+	}
+	if delta := testutil.ToFloat64(cacheRequests.WithLabelValues("test", "hit")) - hits; delta != 1 {
+		t.Errorf("Expected 1 more hit in metrics, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(cacheRequests.WithLabelValues("test", "miss")) - misses; delta != 3 {
+		t.Errorf("Expected 3 more misses in metrics, got %v", delta)
+	}
+}
+
+func TestTTLCacheDisabled(t *testing.T) {
+	c := newTTLCache("test", 0)
+	if c != nil {
+		t.Fatal("Expected a nil cache")
+	}
+	c.set("a", 1)
+	if _, ok := c.get("a"); ok {
+		t.Error("Unexpected hit in a disabled cache")
+	}
+}
+
+// vmCounter is a fake CloudStack API server which
+// counts the listVirtualMachines calls.
+type vmCounter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *vmCounter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	command := req.FormValue("command")
+	if command != "listVirtualMachines" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+		return
+	}
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	fmt.Fprint(w, `{"listvirtualmachinesresponse":{"count":1,"virtualmachine":[{"id":"vm-1","zoneid":"zone-1"}]}}`)
+}
+
+func TestGetVMByIDCache(t *testing.T) {
+	counter := &vmCounter{}
+	server := httptest.NewServer(counter)
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL, CacheTTL: time.Minute}).(*client)
+	ctx := context.Background()
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues(cacheVM, "hit"))
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues(cacheVM, "miss"))
+
+	for i := 0; i < 3; i++ {
+		vm, err := c.GetVMByID(ctx, "vm-1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if vm.ID != "vm-1" || vm.ZoneID != "zone-1" {
+			t.Errorf("Unexpected VM %+v", vm)
+		}
+		// The cached VM must not be modified by callers
+		vm.ZoneID = "modified"
+	}
+	if counter.calls != 1 {
+		t.Errorf("Expected 1 API call, got %d", counter.calls)
+	}
+
+	c.invalidateVM("vm-1")
+	if _, err := c.GetVMByID(ctx, "vm-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if counter.calls != 2 {
+		t.Errorf("Expected 2 API calls after invalidation, got %d", counter.calls)
+	}
+
+	if delta := testutil.ToFloat64(cacheRequests.WithLabelValues(cacheVM, "hit")) - hits; delta != 2 {
+		t.Errorf("Expected 2 more hits in metrics, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(cacheRequests.WithLabelValues(cacheVM, "miss")) - misses; delta != 2 {
+		t.Errorf("Expected 2 more misses in metrics, got %v", delta)
+	}
+}
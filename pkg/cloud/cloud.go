@@ -5,6 +5,7 @@ package cloud
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/apache/cloudstack-go/v2/cloudstack"
 )
@@ -13,15 +14,52 @@ import (
 type Interface interface {
 	GetNodeInfo(ctx context.Context, vmName string) (*VM, error)
 	GetVMByID(ctx context.Context, vmID string) (*VM, error)
+	GetMaxDataVolumes(ctx context.Context, hypervisor string) (int, error)
 
 	ListZonesID(ctx context.Context) ([]string, error)
 
+	GetDiskOfferingByID(ctx context.Context, diskOfferingID string) (*DiskOffering, error)
+	GetDiskOfferingByName(ctx context.Context, name string) (*DiskOffering, error)
+	// GetDiskOfferingByTags returns the disk offering
+	// which has all the given storage tags.
+	GetDiskOfferingByTags(ctx context.Context, tags []string) (*DiskOffering, error)
+	// GetStoragePoolsCapacity gives the size which can still be allocated
+	// for volumes of a disk offering in the storage pools of a zone. For
+	// local offerings, only the pools of the given host are counted, and
+	// the capacity is zero if no host is given.
+	GetStoragePoolsCapacity(ctx context.Context, zoneID, hostID string, offering *DiskOffering) (int64, error)
+	GetAvailablePrimaryStorage(ctx context.Context) (int64, error)
+
 	GetVolumeByID(ctx context.Context, volumeID string) (*Volume, error)
 	GetVolumeByName(ctx context.Context, name string) (*Volume, error)
-	CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB int64) (string, error)
+	// ListVolumes lists a page of the data disks with all the given
+	// tags, if any. It also returns the total number of such volumes.
+	ListVolumes(ctx context.Context, tags map[string]string, page, pageSize int) ([]Volume, int, error)
+	ListVolumesByVM(ctx context.Context, vmID string) ([]Volume, error)
+	// CreateVolume creates a volume. sizeInGB must be zero for disk
+	// offerings which are not customized, and minIOPS and maxIOPS for
+	// disk offerings without customized IOPS. Zero values are not set.
+	CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB, minIOPS, maxIOPS int64) (string, error)
+	CreateVolumeFromSnapshot(ctx context.Context, snapshotID, name string) (string, error)
+	// DeleteVolume deletes a volume. It returns an error wrapping
+	// ErrNotFound if the volume does not exist, and ErrInvalidParameter
+	// if it cannot be deleted, e.g. because it is attached to a VM.
 	DeleteVolume(ctx context.Context, id string) error
+	ResizeVolume(ctx context.Context, volumeID string, sizeInGB int64) error
 	AttachVolume(ctx context.Context, volumeID, vmID string) (string, error)
 	DetachVolume(ctx context.Context, volumeID string) error
+	// TagVolume adds to a volume the given resource tags it does not
+	// have yet, according to vol.Tags, as listed by the caller.
+	// Existing tags are left unchanged.
+	TagVolume(ctx context.Context, vol *Volume, tags map[string]string) error
+
+	GetSnapshotByID(ctx context.Context, snapshotID string) (*Snapshot, error)
+	GetSnapshotByName(ctx context.Context, name string) (*Snapshot, error)
+	ListSnapshots(ctx context.Context, volumeID string) ([]Snapshot, error)
+	CreateSnapshot(ctx context.Context, volumeID, name string) (*Snapshot, error)
+	// DeleteSnapshot deletes a snapshot. It returns an error
+	// wrapping ErrNotFound if the snapshot does not exist.
+	DeleteSnapshot(ctx context.Context, id string) error
 }
 
 // Volume represents a CloudStack volume.
@@ -32,32 +70,159 @@ type Volume struct {
 	// Size in Bytes
 	Size int64
 
+	// IOPS, for disk offerings with customized IOPS
+	MinIOPS int64
+	MaxIOPS int64
+
 	DiskOfferingID string
 	ZoneID         string
 
 	VirtualMachineID string
 	DeviceID         string
+
+	// ID of the snapshot the volume was created from, if any
+	SnapshotID string
+
+	// CloudStack state of the volume, e.g. Ready or Destroy
+	State string
+
+	// Resource tags, by key
+	Tags map[string]string
+
+	CreatedAt time.Time
+}
+
+// Volume states
+const (
+	VolumeStateAllocated          = "Allocated"
+	VolumeStateCreating           = "Creating"
+	VolumeStateReady              = "Ready"
+	VolumeStateResizing           = "Resizing"
+	VolumeStateMigrating          = "Migrating"
+	VolumeStateCopying            = "Copying"
+	VolumeStateSnapshotting       = "Snapshotting"
+	VolumeStateRevertSnapshotting = "RevertSnapshotting"
+	VolumeStateAttaching          = "Attaching"
+	VolumeStateDestroy            = "Destroy"
+	VolumeStateExpunging          = "Expunging"
+	VolumeStateExpunged           = "Expunged"
+)
+
+// Snapshot represents a CloudStack volume snapshot.
+type Snapshot struct {
+	ID   string
+	Name string
+
+	// Size in Bytes of the source volume
+	Size int64
+
+	VolumeID string
+	ZoneID   string
+
+	State     string
+	CreatedAt time.Time
+}
+
+// Snapshot states
+const (
+	// SnapshotStateBackedUp is the state of a snapshot which is
+	// ready to be used as a volume source.
+	SnapshotStateBackedUp = "BackedUp"
+)
+
+// DiskOffering represents a CloudStack disk offering.
+type DiskOffering struct {
+	ID   string
+	Name string
+
+	// StorageType is either "shared" or "local"
+	StorageType string
+	Tags        []string
+
+	// Customized is true if volumes of the offering may have any
+	// size. Otherwise, they have the fixed Size (in Bytes).
+	Customized bool
+	Size       int64
+
+	// CustomizedIOPS is true if the min and max IOPS
+	// of volumes are set when creating them.
+	CustomizedIOPS bool
+}
+
+// IsLocal returns true if volumes of the offering are
+// allocated on host-local storage.
+func (o *DiskOffering) IsLocal() bool {
+	return o.StorageType == storageTypeLocal
 }
 
+const (
+	storageTypeLocal     = "local"
+	storagePoolScopeHost = "HOST"
+)
+
+// listPageSize is the number of resources listed
+// per call when walking all the pages of a listing.
+const listPageSize = 500
+
+// UnlimitedCapacity is the capacity returned
+// when no limit applies.
+const UnlimitedCapacity int64 = -1
+
 // VM represents a CloudStack Virtual Machine.
 type VM struct {
-	ID     string
-	ZoneID string
+	ID         string
+	ZoneID     string
+	HostID     string
+	Hypervisor string
 }
 
 // Specific errors
 var (
 	ErrNotFound       = errors.New("not found")
 	ErrTooManyResults = errors.New("too many results")
+
+	ErrInvalidParameter    = errors.New("invalid parameter")
+	ErrUnsupported         = errors.New("unsupported action")
+	ErrLimitExceeded       = errors.New("resource limit exceeded")
+	ErrConcurrentOperation = errors.New("concurrent operation in progress")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrRateLimited         = errors.New("API rate limit exceeded")
 )
 
 // client is the implementation of Interface.
 type client struct {
 	*cloudstack.CloudStackClient
+	projectID    string
+	zones        []string
+	retryConfig  RetryConfig
+	rateLimiters rateLimiters
+
+	vmCache    *ttlCache
+	nodeCache  *ttlCache
+	zonesCache *ttlCache
 }
 
 // New creates a new cloud connector, given its configuration.
 func New(config *Config) Interface {
 	csClient := cloudstack.NewAsyncClient(config.APIURL, config.APIKey, config.SecretKey, config.VerifySSL)
-	return &client{csClient}
+	return &client{
+		CloudStackClient: csClient,
+		projectID:        config.ProjectID,
+		zones:            config.Zones,
+		retryConfig:      config.Retry,
+		rateLimiters:     newRateLimiters(config.RateLimit),
+		vmCache:          newTTLCache(cacheVM, config.CacheTTL),
+		nodeCache:        newTTLCache(cacheNode, config.CacheTTL),
+		zonesCache:       newTTLCache(cacheZones, config.CacheTTL),
+	}
+}
+
+// setProjectID sets the configured project, if any, on the parameters
+// of a CloudStack API call, and adds it to the logged parameters.
+func (c *client) setProjectID(p cloudstack.ProjectIDSetter, params map[string]string) {
+	if c.projectID == "" {
+		return
+	}
+	p.SetProjectid(c.projectID)
+	params["projectid"] = c.projectID
 }
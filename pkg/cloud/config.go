@@ -2,6 +2,8 @@ package cloud
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gopkg.in/gcfg.v1"
 )
@@ -12,8 +14,65 @@ type Config struct {
 	APIKey    string
 	SecretKey string
 	VerifySSL bool
+
+	// ProjectID is the ID of the CloudStack project
+	// in which volumes are managed. It is optional.
+	ProjectID string
+
+	// Zones is the list of IDs or names of the zones where volumes
+	// may be provisioned. If empty, all available zones are used.
+	Zones []string
+
+	// Retry configures the retries of CloudStack API
+	// calls failing with transient errors.
+	Retry RetryConfig
+
+	// RateLimit configures the client-side rate
+	// limiting of CloudStack API calls.
+	RateLimit RateLimitConfig
+
+	// CacheTTL is the duration during which VM and zone
+	// lookups are cached. Zero disables caching.
+	CacheTTL time.Duration
 }
 
+// RetryConfig holds the configuration of API call retries.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries
+	// of a call. Zero disables retries.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry.
+	// It doubles at each retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Default retry configuration
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RateLimitConfig holds the token bucket parameters of CloudStack
+// API calls: reads, and jobs i.e. calls which create, modify or delete
+// resources. A zero QPS disables the rate limiting of a class.
+type RateLimitConfig struct {
+	ReadQPS   float64
+	ReadBurst int
+	JobQPS    float64
+	JobBurst  int
+}
+
+// Default rate limit configuration
+const (
+	defaultReadQPS   = 20
+	defaultReadBurst = 40
+	defaultJobQPS    = 5
+	defaultJobBurst  = 10
+)
+
 // csConfig wraps the config for the CloudStack cloud provider.
 // It is taken from https://github.com/apache/cloudstack-kubernetes-provider
 // in order to have the same config in cloudstack-kubernetes-provider
@@ -27,20 +86,96 @@ type csConfig struct {
 		ProjectID   string `gcfg:"project-id"`
 		Zone        string `gcfg:"zone"`
 	}
+
+	// Retry is specific to cloudstack-csi-driver
+	Retry struct {
+		MaxRetries     int    `gcfg:"max-retries"`
+		InitialBackoff string `gcfg:"initial-backoff"`
+		MaxBackoff     string `gcfg:"max-backoff"`
+	}
+
+	// RateLimit is specific to cloudstack-csi-driver
+	RateLimit struct {
+		ReadQPS   float64 `gcfg:"read-qps"`
+		ReadBurst int     `gcfg:"read-burst"`
+		JobQPS    float64 `gcfg:"job-qps"`
+		JobBurst  int     `gcfg:"job-burst"`
+	}
+
+	// Cache is specific to cloudstack-csi-driver
+	Cache struct {
+		TTL string `gcfg:"ttl"`
+	}
 }
 
 // ReadConfig reads a config file with a format defined by CloudStack
 // Cloud Controller Manager, and returns a CloudStackConfig.
 func ReadConfig(configFilePath string) (*Config, error) {
 	cfg := &csConfig{}
+	cfg.Retry.MaxRetries = defaultMaxRetries
+	cfg.RateLimit.ReadQPS = defaultReadQPS
+	cfg.RateLimit.ReadBurst = defaultReadBurst
+	cfg.RateLimit.JobQPS = defaultJobQPS
+	cfg.RateLimit.JobBurst = defaultJobBurst
 	if err := gcfg.ReadFileInto(cfg, configFilePath); err != nil {
 		return nil, fmt.Errorf("could not parse CloudStack config: %w", err)
 	}
 
+	retry := RetryConfig{
+		MaxRetries:     cfg.Retry.MaxRetries,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+	}
+	if retry.MaxRetries < 0 {
+		return nil, fmt.Errorf("invalid max-retries %d", retry.MaxRetries)
+	}
+	var err error
+	if cfg.Retry.InitialBackoff != "" {
+		if retry.InitialBackoff, err = time.ParseDuration(cfg.Retry.InitialBackoff); err != nil {
+			return nil, fmt.Errorf("invalid initial-backoff: %w", err)
+		}
+	}
+	if cfg.Retry.MaxBackoff != "" {
+		if retry.MaxBackoff, err = time.ParseDuration(cfg.Retry.MaxBackoff); err != nil {
+			return nil, fmt.Errorf("invalid max-backoff: %w", err)
+		}
+	}
+
+	rateLimit := RateLimitConfig(cfg.RateLimit)
+	if rateLimit.ReadQPS < 0 || rateLimit.JobQPS < 0 {
+		return nil, fmt.Errorf("invalid rate limit: negative QPS")
+	}
+	if (rateLimit.ReadQPS > 0 && rateLimit.ReadBurst < 1) || (rateLimit.JobQPS > 0 && rateLimit.JobBurst < 1) {
+		return nil, fmt.Errorf("invalid rate limit: burst must be at least 1")
+	}
+
+	var cacheTTL time.Duration
+	if cfg.Cache.TTL != "" {
+		if cacheTTL, err = time.ParseDuration(cfg.Cache.TTL); err != nil {
+			return nil, fmt.Errorf("invalid cache ttl: %w", err)
+		}
+	}
+
 	return &Config{
 		APIURL:    cfg.Global.APIURL,
 		APIKey:    cfg.Global.APIKey,
 		SecretKey: cfg.Global.SecretKey,
 		VerifySSL: cfg.Global.SSLNoVerify,
+		ProjectID: cfg.Global.ProjectID,
+		Zones:     splitZones(cfg.Global.Zone),
+		Retry:     retry,
+		RateLimit: rateLimit,
+		CacheTTL:  cacheTTL,
 	}, nil
 }
+
+// splitZones splits a comma-separated list of zones.
+func splitZones(zones string) []string {
+	result := []string{}
+	for _, zone := range strings.Split(zones, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			result = append(result, zone)
+		}
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package cloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cloud-config")
+	content := `[Global]
+api-url = https://cloudstack.example.com/client/api
+api-key = key
+secret-key = secret
+project-id = 4b8a1b5b-6b7c-4b5b-9ee4-2d1e1c3a9f0e
+zone = zone-1, zone-2
+
+[Cache]
+ttl = 5m
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.APIURL != "https://cloudstack.example.com/client/api" {
+		t.Errorf("Unexpected API URL %q", config.APIURL)
+	}
+	if config.APIKey != "key" || config.SecretKey != "secret" {
+		t.Errorf("Unexpected credentials %q / %q", config.APIKey, config.SecretKey)
+	}
+	if config.ProjectID != "4b8a1b5b-6b7c-4b5b-9ee4-2d1e1c3a9f0e" {
+		t.Errorf("Unexpected project ID %q", config.ProjectID)
+	}
+	if len(config.Zones) != 2 || config.Zones[0] != "zone-1" || config.Zones[1] != "zone-2" {
+		t.Errorf("Unexpected zones %v", config.Zones)
+	}
+	if config.CacheTTL != 5*time.Minute {
+		t.Errorf("Unexpected cache TTL %v", config.CacheTTL)
+	}
+}
+
+func TestReadConfigRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name        string
+		content     string
+		expected    RetryConfig
+		expectError bool
+	}{
+		{"defaults", "", RetryConfig{3, time.Second, 30 * time.Second}, false},
+		{"custom", "[Retry]\nmax-retries = 5\ninitial-backoff = 500ms\nmax-backoff = 1m\n", RetryConfig{5, 500 * time.Millisecond, time.Minute}, false},
+		{"disabled", "[Retry]\nmax-retries = 0\n", RetryConfig{0, time.Second, 30 * time.Second}, false},
+		{"negative", "[Retry]\nmax-retries = -1\n", RetryConfig{}, true},
+		{"invalid duration", "[Retry]\ninitial-backoff = soon\n", RetryConfig{}, true},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("cloud-config-%d", i))
+			content := "[Global]\napi-url = https://cloudstack.example.com/client/api\n" + c.content
+			if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := ReadConfig(path)
+			if c.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", config.Retry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.Retry != c.expected {
+				t.Errorf("Expected %+v, got %+v", c.expected, config.Retry)
+			}
+		})
+	}
+}
+
+func TestReadConfigRateLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name        string
+		content     string
+		expected    RateLimitConfig
+		expectError bool
+	}{
+		{"defaults", "", RateLimitConfig{20, 40, 5, 10}, false},
+		{"custom", "[RateLimit]\nread-qps = 2.5\nread-burst = 5\njob-qps = 0.5\njob-burst = 1\n", RateLimitConfig{2.5, 5, 0.5, 1}, false},
+		{"disabled", "[RateLimit]\nread-qps = 0\njob-qps = 0\n", RateLimitConfig{0, 40, 0, 10}, false},
+		{"negative", "[RateLimit]\nread-qps = -1\n", RateLimitConfig{}, true},
+		{"no burst", "[RateLimit]\njob-burst = 0\n", RateLimitConfig{}, true},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("cloud-config-%d", i))
+			content := "[Global]\napi-url = https://cloudstack.example.com/client/api\n" + c.content
+			if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := ReadConfig(path)
+			if c.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", config.RateLimit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.RateLimit != c.expected {
+				t.Errorf("Expected %+v, got %+v", c.expected, config.RateLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package cloud
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/util"
+)
+
+func (c *client) GetDiskOfferingByID(ctx context.Context, diskOfferingID string) (*DiskOffering, error) {
+	p := c.DiskOffering.NewListDiskOfferingsParams()
+	p.SetId(diskOfferingID)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListDiskOfferings", "params", map[string]string{
+		"id": diskOfferingID,
+	})
+	var l *cloudstack.ListDiskOfferingsResponse
+	err := c.retry(ctx, "ListDiskOfferings", func() error {
+		var err error
+		l, err = c.DiskOffering.ListDiskOfferings(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l.Count == 0 {
+		return nil, ErrNotFound
+	}
+	if l.Count > 1 {
+		return nil, ErrTooManyResults
+	}
+	return toDiskOffering(l.DiskOfferings[0]), nil
+}
+
+func (c *client) GetDiskOfferingByName(ctx context.Context, name string) (*DiskOffering, error) {
+	p := c.DiskOffering.NewListDiskOfferingsParams()
+	p.SetName(name)
+	offerings, err := c.listDiskOfferings(ctx, p, map[string]string{
+		"name": name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The name filter of CloudStack may not be exact
+	var result *DiskOffering
+	for _, offering := range offerings {
+		if offering.Name != name {
+			continue
+		}
+		if result != nil {
+			return nil, ErrTooManyResults
+		}
+		result = toDiskOffering(offering)
+	}
+	if result == nil {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (c *client) GetDiskOfferingByTags(ctx context.Context, tags []string) (*DiskOffering, error) {
+	p := c.DiskOffering.NewListDiskOfferingsParams()
+	offerings, err := c.listDiskOfferings(ctx, p, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	var result *DiskOffering
+	for _, offering := range offerings {
+		o := toDiskOffering(offering)
+		if !hasTags(o, tags) {
+			continue
+		}
+		if result != nil {
+			return nil, ErrTooManyResults
+		}
+		result = o
+	}
+	if result == nil {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// listDiskOfferings lists all the pages of disk offerings
+// matching p, whose parameters are logged with params.
+func (c *client) listDiskOfferings(ctx context.Context, p *cloudstack.ListDiskOfferingsParams, params map[string]string) ([]*cloudstack.DiskOffering, error) {
+	p.SetPagesize(listPageSize)
+	params["pagesize"] = strconv.Itoa(listPageSize)
+	var offerings []*cloudstack.DiskOffering
+	for page := 1; ; page++ {
+		p.SetPage(page)
+		params["page"] = strconv.Itoa(page)
+		ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListDiskOfferings", "params", params)
+		var l *cloudstack.ListDiskOfferingsResponse
+		err := c.retry(ctx, "ListDiskOfferings", func() error {
+			var err error
+			l, err = c.DiskOffering.ListDiskOfferings(p)
+			return apiError(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		offerings = append(offerings, l.DiskOfferings...)
+		if len(l.DiskOfferings) == 0 || len(offerings) >= l.Count {
+			return offerings, nil
+		}
+	}
+}
+
+// hasTags checks whether a disk offering has all the given storage tags.
+func hasTags(offering *DiskOffering, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range offering.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func toDiskOffering(offering *cloudstack.DiskOffering) *DiskOffering {
+	return &DiskOffering{
+		ID:          offering.Id,
+		Name:        offering.Name,
+		StorageType: offering.Storagetype,
+		Tags:        splitTags(offering.Tags),
+		Customized:  offering.Iscustomized,
+		Size:        util.GigaBytesToBytes(offering.Disksize),
+
+		CustomizedIOPS: offering.Iscustomizediops,
+	}
+}
+
+// splitTags splits a comma-separated list of CloudStack storage tags.
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// diskOfferingsServer is a fake CloudStack API server which lists
+// disk offerings two per page, ignoring filters and the page size.
+type diskOfferingsServer struct{}
+
+func (diskOfferingsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	pages := map[string]string{
+		"1": `{"id":"small","name":"Small","tags":"ssd","disksize":5},
+			{"id":"small-fast","name":"Small fast","tags":"ssd,fast","iscustomized":true}`,
+		"2": `{"id":"large","name":"Large","tags":"hdd"},
+			{"id":"large-2","name":"Large","tags":"hdd,archive"}`,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"listdiskofferingsresponse":{"count":4,"diskoffering":[%s]}}`, pages[req.FormValue("page")])
+}
+
+func TestGetDiskOfferingByNameOrTags(t *testing.T) {
+	server := httptest.NewServer(diskOfferingsServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	byName := []struct {
+		name       string
+		expectedID string
+		expected   error
+	}{
+		{"Small", "small", nil},
+		{"Large", "", ErrTooManyResults},
+		{"Medium", "", ErrNotFound},
+	}
+	for _, tc := range byName {
+		offering, err := c.GetDiskOfferingByName(ctx, tc.name)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("Name %q: expected error %v, got %v", tc.name, tc.expected, err)
+		}
+		if err == nil && offering.ID != tc.expectedID {
+			t.Errorf("Name %q: expected %q, got %q", tc.name, tc.expectedID, offering.ID)
+		}
+	}
+
+	byTags := []struct {
+		tags       []string
+		expectedID string
+		expected   error
+	}{
+		{[]string{"fast"}, "small-fast", nil},
+		{[]string{"ssd", "fast"}, "small-fast", nil},
+		{[]string{"archive"}, "large-2", nil},
+		{[]string{"ssd"}, "", ErrTooManyResults},
+		{[]string{"nvme"}, "", ErrNotFound},
+	}
+	for _, tc := range byTags {
+		offering, err := c.GetDiskOfferingByTags(ctx, tc.tags)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("Tags %v: expected error %v, got %v", tc.tags, tc.expected, err)
+		}
+		if err == nil && offering.ID != tc.expectedID {
+			t.Errorf("Tags %v: expected %q, got %q", tc.tags, tc.expectedID, offering.ID)
+		}
+	}
+}
+
+func TestDiskOfferingSize(t *testing.T) {
+	server := httptest.NewServer(diskOfferingsServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	fixed, err := c.GetDiskOfferingByName(ctx, "Small")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fixed.Customized || fixed.Size != 5*1024*1024*1024 {
+		t.Errorf("Expected a fixed size of 5 GB, got %+v", fixed)
+	}
+
+	custom, err := c.GetDiskOfferingByName(ctx, "Small fast")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !custom.Customized || custom.Size != 0 {
+		t.Errorf("Expected a customized offering, got %+v", custom)
+	}
+}
@@ -0,0 +1,113 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CloudStack API error codes, from ApiErrorCode.
+const (
+	errorCodeUnauthorized         = 401
+	errorCodeAPILimitExceeded     = 429
+	errorCodeMalformedParameter   = 430
+	errorCodeParamError           = 431
+	errorCodeUnsupportedAction    = 432
+	errorCodeAccountError         = 531
+	errorCodeResourceLimitError   = 532
+	errorCodeInsufficientCapacity = 533
+	errorCodeResourceAllocation   = 535
+	errorCodeResourceInUse        = 536
+)
+
+// APIError is an error returned by the CloudStack API.
+//
+// It wraps one of ErrNotFound, ErrInvalidParameter, ErrUnsupported,
+// ErrLimitExceeded, ErrConcurrentOperation or ErrUnauthorized when its
+// kind is known, to be checked with errors.Is.
+type APIError struct {
+	ErrorCode   int
+	CSErrorCode int
+	Message     string
+
+	kind error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("CloudStack API error %d (CSExceptionErrorCode: %d): %s", e.ErrorCode, e.CSErrorCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// syncErrorRegexp matches the errors of synchronous API calls
+// formatted by cloudstack-go.
+var syncErrorRegexp = regexp.MustCompile(`^CloudStack API error (\d+) \(CSExceptionErrorCode: (\d+)\): (?s)(.*)$`)
+
+// asyncErrorPrefix prefixes the errors of failed asynchronous jobs
+// returned by cloudstack-go, followed by the JSON job result.
+const asyncErrorPrefix = "Undefined error: "
+
+// notFoundRegexp matches the messages of parameter
+// errors caused by resources which do not exist.
+var notFoundRegexp = regexp.MustCompile(`(?i)unable to find|unable to aquire|unable to acquire|not found|does not exist|cannot find|couldn't find`)
+
+// apiError converts an error returned by cloudstack-go to an *APIError,
+// if it can be parsed. Other errors are returned unchanged.
+func apiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+
+	var e *APIError
+	if m := syncErrorRegexp.FindStringSubmatch(msg); m != nil {
+		errorCode, _ := strconv.Atoi(m[1])
+		csErrorCode, _ := strconv.Atoi(m[2])
+		e = &APIError{ErrorCode: errorCode, CSErrorCode: csErrorCode, Message: m[3]}
+	} else if strings.HasPrefix(msg, asyncErrorPrefix) {
+		var result struct {
+			ErrorCode   int    `json:"errorcode"`
+			CSErrorCode int    `json:"cserrorcode"`
+			ErrorText   string `json:"errortext"`
+		}
+		if json.Unmarshal([]byte(strings.TrimPrefix(msg, asyncErrorPrefix)), &result) != nil || result.ErrorCode == 0 {
+			return err
+		}
+		e = &APIError{ErrorCode: result.ErrorCode, CSErrorCode: result.CSErrorCode, Message: result.ErrorText}
+	} else {
+		return err
+	}
+
+	e.kind = errorKind(e.ErrorCode, e.Message)
+	return e
+}
+
+// errorKind gives the specific error corresponding
+// to a CloudStack API error, or nil if none matches.
+func errorKind(errorCode int, message string) error {
+	switch errorCode {
+	case errorCodeUnauthorized, errorCodeAccountError:
+		return ErrUnauthorized
+	case errorCodeParamError:
+		if notFoundRegexp.MatchString(message) {
+			return ErrNotFound
+		}
+		return ErrInvalidParameter
+	case errorCodeMalformedParameter:
+		return ErrInvalidParameter
+	case errorCodeUnsupportedAction:
+		return ErrUnsupported
+	case errorCodeAPILimitExceeded, errorCodeResourceLimitError, errorCodeInsufficientCapacity, errorCodeResourceAllocation:
+		return ErrLimitExceeded
+	case errorCodeResourceInUse:
+		return ErrConcurrentOperation
+	}
+	if strings.Contains(strings.ToLower(message), "concurrent") {
+		return ErrConcurrentOperation
+	}
+	return nil
+}
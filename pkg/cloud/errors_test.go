@@ -0,0 +1,56 @@
+package cloud
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"nil", nil, nil},
+		{"not found", errors.New("CloudStack API error 431 (CSExceptionErrorCode: 4350): Unable to execute API command listvolumes due to invalid value. Invalid parameter id value=1234 due to incorrect long value format, or entity does not exist or due to incorrect parameter annotation for the field in api cmd class."),
+			ErrNotFound},
+		{"invalid parameter", errors.New("CloudStack API error 431 (CSExceptionErrorCode: 4350): Volume size must be greater than 0"), ErrInvalidParameter},
+		{"malformed parameter", errors.New("CloudStack API error 430 (CSExceptionErrorCode: 9999): Unable to decode parameter size"), ErrInvalidParameter},
+		{"unsupported action", errors.New("CloudStack API error 432 (CSExceptionErrorCode: 9999): The given command does not exist or it is not available for user"), ErrUnsupported},
+		{"API limit", errors.New("CloudStack API error 429 (CSExceptionErrorCode: 9999): The given user has reached his/her account api limit, please retry after 1000 ms."), ErrLimitExceeded},
+		{"resource limit", errors.New("CloudStack API error 532 (CSExceptionErrorCode: 4370): Maximum number of resources of type 'primary_storage' for account name=admin in domain id=1 has been exceeded."),
+			ErrLimitExceeded},
+		{"unauthorized", errors.New("CloudStack API error 401 (CSExceptionErrorCode: 0): unable to verify user credentials and/or request signature"), ErrUnauthorized},
+		{"permission denied", errors.New("CloudStack API error 531 (CSExceptionErrorCode: 4365): Account Account [{accountName: \"user\"}] does not have permission to operate within domain"),
+			ErrUnauthorized},
+		{"resource in use", errors.New("CloudStack API error 536 (CSExceptionErrorCode: 9999): Volume is in use"), ErrConcurrentOperation},
+		{"async concurrent", errors.New(`Undefined error: {"cserrorcode":4250,"errorcode":530,"errortext":"There is concurrent operation on the volume"}`),
+			ErrConcurrentOperation},
+		{"async resource limit", errors.New(`Undefined error: {"cserrorcode":4370,"errorcode":533,"errortext":"Insufficient capacity"}`), ErrLimitExceeded},
+		{"internal", errors.New("CloudStack API error 530 (CSExceptionErrorCode: 9999): Internal error executing command"), nil},
+		{"other", errors.New("connection refused"), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := apiError(c.err)
+			if c.err == nil {
+				if err != nil {
+					t.Errorf("Expected nil, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if err.Error() != c.err.Error() && c.expected == nil {
+				t.Errorf("Expected unchanged message %q, got %q", c.err.Error(), err.Error())
+			}
+			kinds := []error{ErrNotFound, ErrInvalidParameter, ErrUnsupported, ErrLimitExceeded, ErrConcurrentOperation, ErrUnauthorized}
+			for _, kind := range kinds {
+				if errors.Is(err, kind) != (kind == c.expected) {
+					t.Errorf("Expected errors.Is(%v) to be %v", kind, kind == c.expected)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ package fake
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/hashicorp/go-uuid"
 
@@ -11,12 +13,17 @@ import (
 	"github.com/apalia/cloudstack-csi-driver/pkg/util"
 )
 
-const zoneID = "a1887604-237c-4212-a9cd-94620b7880fa"
+const (
+	zoneID         = "a1887604-237c-4212-a9cd-94620b7880fa"
+	diskOfferingID = "9743fd77-0f5d-4ef9-b2f8-f194235c769c"
+)
 
 type fakeConnector struct {
-	node          *cloud.VM
-	volumesByID   map[string]cloud.Volume
-	volumesByName map[string]cloud.Volume
+	node            *cloud.VM
+	volumesByID     map[string]cloud.Volume
+	volumesByName   map[string]cloud.Volume
+	snapshotsByID   map[string]cloud.Snapshot
+	snapshotsByName map[string]cloud.Snapshot
 }
 
 // New returns a new fake implementation of the
@@ -26,19 +33,24 @@ func New() cloud.Interface {
 		ID:               "ace9f28b-3081-40c1-8353-4cc3e3014072",
 		Name:             "vol-1",
 		Size:             10,
-		DiskOfferingID:   "9743fd77-0f5d-4ef9-b2f8-f194235c769c",
+		DiskOfferingID:   diskOfferingID,
 		ZoneID:           zoneID,
 		VirtualMachineID: "",
 		DeviceID:         "",
+		State:            cloud.VolumeStateReady,
 	}
 	node := &cloud.VM{
-		ID:     "0d7107a3-94d2-44e7-89b8-8930881309a5",
-		ZoneID: zoneID,
+		ID:         "0d7107a3-94d2-44e7-89b8-8930881309a5",
+		ZoneID:     zoneID,
+		HostID:     "5c8b2a4b-3d1e-4f4f-8b8a-6c7d0e9f1a2b",
+		Hypervisor: "KVM",
 	}
 	return &fakeConnector{
-		node:          node,
-		volumesByID:   map[string]cloud.Volume{volume.ID: volume},
-		volumesByName: map[string]cloud.Volume{volume.Name: volume},
+		node:            node,
+		volumesByID:     map[string]cloud.Volume{volume.ID: volume},
+		volumesByName:   map[string]cloud.Volume{volume.Name: volume},
+		snapshotsByID:   make(map[string]cloud.Snapshot),
+		snapshotsByName: make(map[string]cloud.Snapshot),
 	}
 }
 
@@ -53,10 +65,51 @@ func (f *fakeConnector) GetNodeInfo(ctx context.Context, vmName string) (*cloud.
 	return f.node, nil
 }
 
+func (f *fakeConnector) GetMaxDataVolumes(ctx context.Context, hypervisor string) (int, error) {
+	return 13, nil
+}
+
 func (f *fakeConnector) ListZonesID(ctx context.Context) ([]string, error) {
 	return []string{zoneID}, nil
 }
 
+func (f *fakeConnector) GetDiskOfferingByID(ctx context.Context, id string) (*cloud.DiskOffering, error) {
+	if id == diskOfferingID {
+		return &cloud.DiskOffering{
+			ID:          diskOfferingID,
+			Name:        "Custom",
+			StorageType: "shared",
+			Tags:        []string{"standard"},
+			Customized:  true,
+		}, nil
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func (f *fakeConnector) GetDiskOfferingByName(ctx context.Context, name string) (*cloud.DiskOffering, error) {
+	if name == "Custom" {
+		return f.GetDiskOfferingByID(ctx, diskOfferingID)
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func (f *fakeConnector) GetDiskOfferingByTags(ctx context.Context, tags []string) (*cloud.DiskOffering, error) {
+	for _, tag := range tags {
+		if tag != "standard" {
+			return nil, cloud.ErrNotFound
+		}
+	}
+	return f.GetDiskOfferingByID(ctx, diskOfferingID)
+}
+
+func (f *fakeConnector) GetStoragePoolsCapacity(ctx context.Context, zoneID, hostID string, offering *cloud.DiskOffering) (int64, error) {
+	return util.GigaBytesToBytes(1024), nil
+}
+
+func (f *fakeConnector) GetAvailablePrimaryStorage(ctx context.Context) (int64, error) {
+	return cloud.UnlimitedCapacity, nil
+}
+
 func (f *fakeConnector) GetVolumeByID(ctx context.Context, volumeID string) (*cloud.Volume, error) {
 	vol, ok := f.volumesByID[volumeID]
 	if ok {
@@ -73,14 +126,72 @@ func (f *fakeConnector) GetVolumeByName(ctx context.Context, name string) (*clou
 	return nil, cloud.ErrNotFound
 }
 
-func (f *fakeConnector) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB int64) (string, error) {
+func (f *fakeConnector) ListVolumes(ctx context.Context, tags map[string]string, page, pageSize int) ([]cloud.Volume, int, error) {
+	volumes := make([]cloud.Volume, 0, len(f.volumesByID))
+	for _, vol := range f.volumesByID {
+		if hasTags(vol.Tags, tags) {
+			volumes = append(volumes, vol)
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].ID < volumes[j].ID })
+	total := len(volumes)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return volumes[start:end], total, nil
+}
+
+func (f *fakeConnector) ListVolumesByVM(ctx context.Context, vmID string) ([]cloud.Volume, error) {
+	volumes := []cloud.Volume{}
+	for _, vol := range f.volumesByID {
+		if vol.VirtualMachineID == vmID {
+			volumes = append(volumes, vol)
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].ID < volumes[j].ID })
+	return volumes, nil
+}
+
+func (f *fakeConnector) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB, minIOPS, maxIOPS int64) (string, error) {
 	id, _ := uuid.GenerateUUID()
 	vol := cloud.Volume{
 		ID:             id,
 		Name:           name,
 		Size:           util.GigaBytesToBytes(sizeInGB),
+		MinIOPS:        minIOPS,
+		MaxIOPS:        maxIOPS,
 		DiskOfferingID: diskOfferingID,
 		ZoneID:         zoneID,
+		State:          cloud.VolumeStateReady,
+		CreatedAt:      time.Now(),
+	}
+	f.volumesByID[vol.ID] = vol
+	f.volumesByName[vol.Name] = vol
+	return vol.ID, nil
+}
+
+func (f *fakeConnector) CreateVolumeFromSnapshot(ctx context.Context, snapshotID, name string) (string, error) {
+	snap, ok := f.snapshotsByID[snapshotID]
+	if !ok {
+		return "", cloud.ErrNotFound
+	}
+	id, _ := uuid.GenerateUUID()
+	vol := cloud.Volume{
+		ID:         id,
+		Name:       name,
+		Size:       snap.Size,
+		ZoneID:     snap.ZoneID,
+		SnapshotID: snap.ID,
+		State:      cloud.VolumeStateReady,
+		CreatedAt:  time.Now(),
+	}
+	if source, ok := f.volumesByID[snap.VolumeID]; ok {
+		vol.DiskOfferingID = source.DiskOfferingID
 	}
 	f.volumesByID[vol.ID] = vol
 	f.volumesByName[vol.Name] = vol
@@ -88,16 +199,113 @@ func (f *fakeConnector) CreateVolume(ctx context.Context, diskOfferingID, zoneID
 }
 
 func (f *fakeConnector) DeleteVolume(ctx context.Context, id string) error {
-	if vol, ok := f.volumesByID[id]; ok {
-		name := vol.Name
-		delete(f.volumesByName, name)
+	vol, ok := f.volumesByID[id]
+	if !ok {
+		return cloud.ErrNotFound
 	}
+	delete(f.volumesByName, vol.Name)
 	delete(f.volumesByID, id)
 	return nil
 }
 
+func (f *fakeConnector) ResizeVolume(ctx context.Context, volumeID string, sizeInGB int64) error {
+	vol, ok := f.volumesByID[volumeID]
+	if !ok {
+		return cloud.ErrNotFound
+	}
+	vol.Size = util.GigaBytesToBytes(sizeInGB)
+	f.volumesByID[vol.ID] = vol
+	f.volumesByName[vol.Name] = vol
+	return nil
+}
+
 func (f *fakeConnector) AttachVolume(ctx context.Context, volumeID, vmID string) (string, error) {
 	return "1", nil
 }
 
 func (f *fakeConnector) DetachVolume(ctx context.Context, volumeID string) error { return nil }
+
+func (f *fakeConnector) TagVolume(ctx context.Context, v *cloud.Volume, tags map[string]string) error {
+	vol, ok := f.volumesByID[v.ID]
+	if !ok {
+		return cloud.ErrNotFound
+	}
+	merged := make(map[string]string, len(vol.Tags)+len(tags))
+	for key, value := range tags {
+		merged[key] = value
+	}
+	for key, value := range vol.Tags {
+		merged[key] = value
+	}
+	vol.Tags = merged
+	f.volumesByID[vol.ID] = vol
+	f.volumesByName[vol.Name] = vol
+	return nil
+}
+
+func (f *fakeConnector) GetSnapshotByID(ctx context.Context, snapshotID string) (*cloud.Snapshot, error) {
+	snap, ok := f.snapshotsByID[snapshotID]
+	if ok {
+		return &snap, nil
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func (f *fakeConnector) GetSnapshotByName(ctx context.Context, name string) (*cloud.Snapshot, error) {
+	snap, ok := f.snapshotsByName[name]
+	if ok {
+		return &snap, nil
+	}
+	return nil, cloud.ErrNotFound
+}
+
+func (f *fakeConnector) ListSnapshots(ctx context.Context, volumeID string) ([]cloud.Snapshot, error) {
+	result := make([]cloud.Snapshot, 0, len(f.snapshotsByID))
+	for _, snap := range f.snapshotsByID {
+		if volumeID == "" || snap.VolumeID == volumeID {
+			result = append(result, snap)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *fakeConnector) CreateSnapshot(ctx context.Context, volumeID, name string) (*cloud.Snapshot, error) {
+	vol, ok := f.volumesByID[volumeID]
+	if !ok {
+		return nil, cloud.ErrNotFound
+	}
+	id, _ := uuid.GenerateUUID()
+	snap := cloud.Snapshot{
+		ID:        id,
+		Name:      name,
+		Size:      vol.Size,
+		VolumeID:  vol.ID,
+		ZoneID:    vol.ZoneID,
+		State:     cloud.SnapshotStateBackedUp,
+		CreatedAt: time.Now(),
+	}
+	f.snapshotsByID[snap.ID] = snap
+	f.snapshotsByName[snap.Name] = snap
+	return &snap, nil
+}
+
+func (f *fakeConnector) DeleteSnapshot(ctx context.Context, id string) error {
+	snap, ok := f.snapshotsByID[id]
+	if !ok {
+		return cloud.ErrNotFound
+	}
+	delete(f.snapshotsByName, snap.Name)
+	delete(f.snapshotsByID, id)
+	return nil
+}
+
+// hasTags checks whether all the given tags are in volumeTags.
+func hasTags(volumeTags, tags map[string]string) bool {
+	for key, value := range tags {
+		if v, ok := volumeTags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
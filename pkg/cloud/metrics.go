@@ -0,0 +1,44 @@
+package cloud
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cloudstack_csi",
+			Subsystem: "cloudstack",
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of CloudStack API calls, including asynchronous jobs, by command and status.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"command", "status"},
+	)
+
+	cacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cloudstack_csi",
+			Subsystem: "cloudstack",
+			Name:      "cache_requests_total",
+			Help:      "Number of lookups in the caches of the CloudStack connector, by cache and result (hit or miss).",
+		},
+		[]string{"cache", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(apiRequestDuration, cacheRequests)
+}
+
+// observeAPIRequest records the duration and the
+// status of a CloudStack API call started at start.
+func observeAPIRequest(command string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	apiRequestDuration.WithLabelValues(command, status).Observe(time.Since(start).Seconds())
+}
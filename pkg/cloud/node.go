@@ -3,6 +3,19 @@ package cloud
 import "context"
 
 func (c *client) GetNodeInfo(ctx context.Context, vmName string) (*VM, error) {
+	if v, ok := c.nodeCache.get(vmName); ok {
+		vm := v.(VM)
+		return &vm, nil
+	}
+	vm, err := c.getNodeInfo(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+	c.nodeCache.set(vmName, *vm)
+	return vm, nil
+}
+
+func (c *client) getNodeInfo(ctx context.Context, vmName string) (*VM, error) {
 	// First, try to read the instance ID from meta-data (cloud-init)
 	if id := c.metadataInstanceID(ctx); id != "" {
 		// Instance ID found using metadata
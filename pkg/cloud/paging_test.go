@@ -0,0 +1,71 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pagedServer is a fake CloudStack API server which lists snapshots,
+// volumes and storage pools two per page, ignoring the page size.
+type pagedServer struct{}
+
+func (pagedServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resources := map[string]struct {
+		name string
+		item string
+	}{
+		"listSnapshots":    {"snapshot", `{"id":"snap-%d"}`},
+		"listVolumes":      {"volume", `{"id":"vol-%d"}`},
+		"listStoragePools": {"storagepool", `{"id":"pool-%d","scope":"ZONE","state":"Up","disksizetotal":100}`},
+	}
+	command := req.FormValue("command")
+	resource, ok := resources[command]
+	if !ok {
+		http.Error(w, "unexpected command", http.StatusBadRequest)
+		return
+	}
+	var items []string
+	switch req.FormValue("page") {
+	case "1":
+		items = []string{fmt.Sprintf(resource.item, 1), fmt.Sprintf(resource.item, 2)}
+	case "2":
+		items = []string{fmt.Sprintf(resource.item, 3)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"%sresponse":{"count":3,"%s":[%s]}}`, strings.ToLower(command), resource.name, strings.Join(items, ","))
+}
+
+func TestListPages(t *testing.T) {
+	server := httptest.NewServer(pagedServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	snapshots, err := c.ListSnapshots(ctx, "vol-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 3 {
+		t.Errorf("Expected 3 snapshots, got %d", len(snapshots))
+	}
+
+	volumes, err := c.ListVolumesByVM(ctx, "vm-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 3 {
+		t.Errorf("Expected 3 volumes, got %d", len(volumes))
+	}
+
+	capacity, err := c.GetStoragePoolsCapacity(ctx, "zone-1", "", &DiskOffering{StorageType: "shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capacity != 300 {
+		t.Errorf("Expected capacity 300 from 3 pools, got %d", capacity)
+	}
+}
@@ -0,0 +1,130 @@
+package cloud
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+)
+
+const storagePoolStateUp = "Up"
+
+func (c *client) GetStoragePoolsCapacity(ctx context.Context, zoneID, hostID string, offering *DiskOffering) (int64, error) {
+	p := c.Pool.NewListStoragePoolsParams()
+	params := map[string]string{}
+	if zoneID != "" {
+		p.SetZoneid(zoneID)
+		params["zoneid"] = zoneID
+	}
+	if offering != nil && offering.IsLocal() {
+		// Host-local pools are not shared: the capacity
+		// of a zone is not available to any single host.
+		if hostID == "" {
+			return 0, nil
+		}
+		// CloudStack does not give the host of a pool, but
+		// host-local pools have the IP address of their host.
+		hostAddress, err := c.getHostAddress(ctx, hostID)
+		if err != nil {
+			return 0, err
+		}
+		p.SetScope(storagePoolScopeHost)
+		p.SetIpaddress(hostAddress)
+		params["scope"] = storagePoolScopeHost
+		params["ipaddress"] = hostAddress
+	}
+	p.SetPagesize(listPageSize)
+	params["pagesize"] = strconv.Itoa(listPageSize)
+
+	var capacity int64
+	var listed int
+	for page := 1; ; page++ {
+		p.SetPage(page)
+		params["page"] = strconv.Itoa(page)
+		ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListStoragePools", "params", params)
+		var l *cloudstack.ListStoragePoolsResponse
+		err := c.retry(ctx, "ListStoragePools", func() error {
+			var err error
+			l, err = c.Pool.ListStoragePools(p)
+			return apiError(err)
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, pool := range l.StoragePools {
+			if pool.State != storagePoolStateUp || !poolMatchesOffering(pool, offering) {
+				continue
+			}
+			if available := poolAvailableBytes(pool); available > 0 {
+				capacity += available
+			}
+		}
+		listed += len(l.StoragePools)
+		if len(l.StoragePools) == 0 || listed >= l.Count {
+			return capacity, nil
+		}
+	}
+}
+
+// getHostAddress gives the IP address of a host.
+func (c *client) getHostAddress(ctx context.Context, hostID string) (string, error) {
+	p := c.Host.NewListHostsParams()
+	p.SetId(hostID)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListHosts", "params", map[string]string{
+		"id": hostID,
+	})
+	var l *cloudstack.ListHostsResponse
+	err := c.retry(ctx, "ListHosts", func() error {
+		var err error
+		l, err = c.Host.ListHosts(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return "", err
+	}
+	if l.Count == 0 {
+		return "", ErrNotFound
+	}
+	if l.Count > 1 {
+		return "", ErrTooManyResults
+	}
+	return l.Hosts[0].Ipaddress, nil
+}
+
+// poolMatchesOffering checks whether volumes of a disk offering
+// may be allocated in a storage pool: the pool must have all
+// storage tags of the offering, and be host-local for local
+// offerings only.
+func poolMatchesOffering(pool *cloudstack.StoragePool, offering *DiskOffering) bool {
+	if offering == nil {
+		return true
+	}
+	if offering.IsLocal() != (pool.Scope == storagePoolScopeHost) {
+		return false
+	}
+	poolTags := splitTags(pool.Tags)
+	for _, tag := range offering.Tags {
+		var found bool
+		for _, poolTag := range poolTags {
+			if poolTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// poolAvailableBytes gives the size which can still be allocated
+// in a storage pool, taking over-provisioning into account.
+func poolAvailableBytes(pool *cloudstack.StoragePool) int64 {
+	factor, err := strconv.ParseFloat(pool.Overprovisionfactor, 64)
+	if err != nil || factor <= 0 {
+		factor = 1
+	}
+	return int64(float64(pool.Disksizetotal)*factor) - pool.Disksizeallocated
+}
@@ -0,0 +1,126 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+)
+
+func TestPoolMatchesOffering(t *testing.T) {
+	cases := []struct {
+		name     string
+		pool     cloudstack.StoragePool
+		offering *DiskOffering
+		expected bool
+	}{
+		{"no offering", cloudstack.StoragePool{Scope: "CLUSTER"}, nil, true},
+		{"no tags", cloudstack.StoragePool{Scope: "CLUSTER"}, &DiskOffering{StorageType: "shared", Tags: []string{}}, true},
+		{"matching tags", cloudstack.StoragePool{Scope: "ZONE", Tags: "ssd, fast"}, &DiskOffering{StorageType: "shared", Tags: []string{"ssd"}}, true},
+		{"missing tag", cloudstack.StoragePool{Scope: "ZONE", Tags: "ssd"}, &DiskOffering{StorageType: "shared", Tags: []string{"ssd", "fast"}}, false},
+		{"local offering, shared pool", cloudstack.StoragePool{Scope: "CLUSTER"}, &DiskOffering{StorageType: "local"}, false},
+		{"local offering, local pool", cloudstack.StoragePool{Scope: "HOST"}, &DiskOffering{StorageType: "local"}, true},
+		{"shared offering, local pool", cloudstack.StoragePool{Scope: "HOST"}, &DiskOffering{StorageType: "shared"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pool := c.pool
+			if res := poolMatchesOffering(&pool, c.offering); res != c.expected {
+				t.Errorf("Expected %v, got %v", c.expected, res)
+			}
+		})
+	}
+}
+
+func TestPoolAvailableBytes(t *testing.T) {
+	cases := []struct {
+		name     string
+		pool     cloudstack.StoragePool
+		expected int64
+	}{
+		{"no over-provisioning", cloudstack.StoragePool{Disksizetotal: 1000, Disksizeallocated: 400, Overprovisionfactor: "1.0"}, 600},
+		{"over-provisioning", cloudstack.StoragePool{Disksizetotal: 1000, Disksizeallocated: 400, Overprovisionfactor: "2.0"}, 1600},
+		{"invalid factor", cloudstack.StoragePool{Disksizetotal: 1000, Disksizeallocated: 400, Overprovisionfactor: ""}, 600},
+		{"over-allocated", cloudstack.StoragePool{Disksizetotal: 1000, Disksizeallocated: 1400, Overprovisionfactor: "1.0"}, -400},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pool := c.pool
+			if res := poolAvailableBytes(&pool); res != c.expected {
+				t.Errorf("Expected %v, got %v", c.expected, res)
+			}
+		})
+	}
+}
+
+// poolsServer is a fake CloudStack API server with a shared
+// storage pool and a host-local pool on each of two hosts.
+type poolsServer struct{}
+
+func (poolsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch req.FormValue("command") {
+	case "listHosts":
+		addresses := map[string]string{"host-1": "10.0.0.1", "host-2": "10.0.0.2"}
+		if address, ok := addresses[req.FormValue("id")]; ok {
+			fmt.Fprintf(w, `{"listhostsresponse":{"count":1,"host":[{"id":%q,"ipaddress":%q}]}}`, req.FormValue("id"), address)
+			return
+		}
+		fmt.Fprint(w, `{"listhostsresponse":{}}`)
+	case "listStoragePools":
+		pools := []struct{ address, pool string }{
+			{"10.0.1.1", `{"id":"shared","scope":"ZONE","state":"Up","ipaddress":"10.0.1.1","disksizetotal":1000}`},
+			{"10.0.0.1", `{"id":"local-1","scope":"HOST","state":"Up","ipaddress":"10.0.0.1","disksizetotal":100}`},
+			{"10.0.0.2", `{"id":"local-2","scope":"HOST","state":"Up","ipaddress":"10.0.0.2","disksizetotal":200}`},
+		}
+		var matching []string
+		for _, p := range pools {
+			if address := req.FormValue("ipaddress"); address == "" || address == p.address {
+				matching = append(matching, p.pool)
+			}
+		}
+		fmt.Fprintf(w, `{"liststoragepoolsresponse":{"count":%d,"storagepool":[%s]}}`, len(matching), strings.Join(matching, ","))
+	default:
+		http.Error(w, "unexpected command", http.StatusBadRequest)
+	}
+}
+
+func TestGetStoragePoolsCapacity(t *testing.T) {
+	server := httptest.NewServer(poolsServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+
+	cases := []struct {
+		name     string
+		hostID   string
+		offering *DiskOffering
+		expected int64
+	}{
+		{"shared offering", "", &DiskOffering{StorageType: "shared"}, 1000},
+		{"shared offering, host", "host-1", &DiskOffering{StorageType: "shared"}, 1000},
+		{"local offering, no host", "", &DiskOffering{StorageType: "local"}, 0},
+		{"local offering, host", "host-1", &DiskOffering{StorageType: "local"}, 100},
+		{"local offering, other host", "host-2", &DiskOffering{StorageType: "local"}, 200},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			capacity, err := c.GetStoragePoolsCapacity(context.Background(), "zone-1", tc.hostID, tc.offering)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if capacity != tc.expected {
+				t.Errorf("Expected capacity %d, got %d", tc.expected, capacity)
+			}
+		})
+	}
+
+	_, err := c.GetStoragePoolsCapacity(context.Background(), "zone-1", "host-3", &DiskOffering{StorageType: "local"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error %v for an unknown host, got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,128 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// projectRecorder is a fake CloudStack API server which
+// records the projectid parameter of each command.
+type projectRecorder struct {
+	mu       sync.Mutex
+	projects map[string]string
+}
+
+func (r *projectRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	command := req.FormValue("command")
+	r.mu.Lock()
+	r.projects[command] = req.FormValue("projectid")
+	r.mu.Unlock()
+
+	var body string
+	switch command {
+	case "listVolumes":
+		body = `{"listvolumesresponse":{"count":1,"volume":[{"id":"vol-1","name":"vol"}]}}`
+	case "createVolume":
+		body = `{"createvolumeresponse":{"jobid":"job-1"}}`
+	case "queryAsyncJobResult":
+		body = `{"queryasyncjobresultresponse":{"jobid":"job-1","jobstatus":1,"jobresult":{"volume":{"id":"vol-1"}}}}`
+	case "listVirtualMachines":
+		body = `{"listvirtualmachinesresponse":{"count":1,"virtualmachine":[{"id":"vm-1","zoneid":"zone-1"}]}}`
+	case "listSnapshots":
+		body = `{"listsnapshotsresponse":{"count":1,"snapshot":[{"id":"snap-1"}]}}`
+	case "listProjects":
+		body = `{"listprojectsresponse":{"count":1,"project":[{"id":"project-1","primarystorageavailable":"10"}]}}`
+	case "listAccounts":
+		body = `{"listaccountsresponse":{"count":1,"account":[{"id":"account-1","primarystorageavailable":"20"}]}}`
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		body = fmt.Sprintf(`{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, body)
+}
+
+func TestProjectID(t *testing.T) {
+	calls := []struct {
+		command string
+		call    func(ctx context.Context, c Interface) error
+	}{
+		{"listVolumes", func(ctx context.Context, c Interface) error {
+			_, err := c.GetVolumeByID(ctx, "vol-1")
+			return err
+		}},
+		{"listVolumes", func(ctx context.Context, c Interface) error {
+			_, err := c.GetVolumeByName(ctx, "vol")
+			return err
+		}},
+		{"listVolumes", func(ctx context.Context, c Interface) error {
+			_, _, err := c.ListVolumes(ctx, nil, 1, 10)
+			return err
+		}},
+		{"createVolume", func(ctx context.Context, c Interface) error {
+			_, err := c.CreateVolume(ctx, "offering-1", "zone-1", "vol", 1, 0, 0)
+			return err
+		}},
+		{"createVolume", func(ctx context.Context, c Interface) error {
+			_, err := c.CreateVolumeFromSnapshot(ctx, "snap-1", "vol")
+			return err
+		}},
+		{"listVirtualMachines", func(ctx context.Context, c Interface) error {
+			_, err := c.GetVMByID(ctx, "vm-1")
+			return err
+		}},
+		{"listSnapshots", func(ctx context.Context, c Interface) error {
+			_, err := c.GetSnapshotByName(ctx, "snap")
+			return err
+		}},
+		{"listSnapshots", func(ctx context.Context, c Interface) error {
+			_, err := c.ListSnapshots(ctx, "vol-1")
+			return err
+		}},
+	}
+
+	for _, projectID := range []string{"", "project-1"} {
+		recorder := &projectRecorder{projects: make(map[string]string)}
+		server := httptest.NewServer(recorder)
+		c := New(&Config{APIURL: server.URL, ProjectID: projectID})
+		ctx := context.Background()
+
+		for _, call := range calls {
+			if err := call.call(ctx, c); err != nil {
+				t.Errorf("%s: unexpected error: %v", call.command, err)
+				continue
+			}
+			if got := recorder.projects[call.command]; got != projectID {
+				t.Errorf("%s: expected projectid %q, got %q", call.command, projectID, got)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestProjectAvailablePrimaryStorage(t *testing.T) {
+	cases := []struct {
+		projectID string
+		expected  int64
+	}{
+		{"", 20 * 1024 * 1024 * 1024},
+		{"project-1", 10 * 1024 * 1024 * 1024},
+	}
+	for _, tc := range cases {
+		server := httptest.NewServer(&projectRecorder{projects: make(map[string]string)})
+		c := New(&Config{APIURL: server.URL, ProjectID: tc.projectID})
+		available, err := c.GetAvailablePrimaryStorage(context.Background())
+		server.Close()
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			continue
+		}
+		if available != tc.expected {
+			t.Errorf("Project %q: expected %d, got %d", tc.projectID, tc.expected, available)
+		}
+	}
+}
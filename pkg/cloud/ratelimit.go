@@ -0,0 +1,65 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// jobCommands are the CloudStack API commands which create, modify
+// or delete resources. Most of them start asynchronous jobs, which
+// are much more expensive for the management server than reads.
+var jobCommands = map[string]bool{
+	"CreateVolume":   true,
+	"DeleteVolume":   true,
+	"ResizeVolume":   true,
+	"AttachVolume":   true,
+	"DetachVolume":   true,
+	"CreateTags":     true,
+	"CreateSnapshot": true,
+	"DeleteSnapshot": true,
+}
+
+// rateLimiters holds the token buckets of CloudStack API calls,
+// one per command class. A nil limiter does not limit calls.
+type rateLimiters struct {
+	read *rate.Limiter
+	job  *rate.Limiter
+}
+
+func newRateLimiters(config RateLimitConfig) rateLimiters {
+	return rateLimiters{
+		read: newRateLimiter(config.ReadQPS, config.ReadBurst),
+		job:  newRateLimiter(config.JobQPS, config.JobBurst),
+	}
+}
+
+func newRateLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// wait blocks until the rate limit of its class allows
+// to call the given command.
+//
+// It fails with ErrRateLimited if the context deadline
+// would be exceeded before the call is allowed.
+func (c *client) wait(ctx context.Context, command string) error {
+	limiter := c.rateLimiters.read
+	if jobCommands[command] {
+		limiter = c.rateLimiters.job
+	}
+	if limiter == nil {
+		return nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %s: %v", ErrRateLimited, command, err)
+	}
+	return nil
+}
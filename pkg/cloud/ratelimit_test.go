@@ -0,0 +1,53 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	c := &client{rateLimiters: newRateLimiters(RateLimitConfig{ReadQPS: 1, ReadBurst: 1, JobQPS: 0.01, JobBurst: 1})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The first call of each class consumes the burst
+	if err := c.wait(ctx, "ListVolumes"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.wait(ctx, "CreateVolume"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The next call would exceed the deadline
+	start := time.Now()
+	if err := c.wait(ctx, "ListVirtualMachines"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if err := c.wait(ctx, "AttachVolume"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected an immediate failure, waited %v", elapsed)
+	}
+
+	// Reads are allowed again after 1s
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel2()
+	if err := c.wait(ctx2, "ListVolumes"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWaitUnlimited(t *testing.T) {
+	c := &client{rateLimiters: newRateLimiters(RateLimitConfig{})}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	for i := 0; i < 100; i++ {
+		if err := c.wait(ctx, "ListVolumes"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
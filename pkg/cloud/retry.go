@@ -0,0 +1,89 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+)
+
+// CloudStack API error codes of transient failures, from ApiErrorCode.
+const (
+	errorCodeInternalError       = 530
+	errorCodeResourceUnavailable = 534
+)
+
+// retry calls fn until it succeeds or fails with an error which
+// is not transient, at most c.retryConfig.MaxRetries+1 times. It waits
+// between attempts with exponential backoff and jitter, and each
+// attempt is subject to the rate limit of the command.
+//
+// fn must be safe to call again after a failure: calls which are
+// not idempotent must check whether the failed attempt succeeded.
+func (c *client) retry(ctx context.Context, command string, fn func() error) error {
+	backoff := c.retryConfig.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if err := c.wait(ctx, command); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := fn()
+		observeAPIRequest(command, start, err)
+		if err == nil || attempt > c.retryConfig.MaxRetries || !isTransient(err) {
+			return err
+		}
+
+		// Full jitter: wait a random delay up to the backoff
+		var delay time.Duration
+		if backoff > 0 {
+			delay = time.Duration(rand.Int63n(int64(backoff)))
+		}
+		ctxzap.Extract(ctx).Sugar().Warnw("CloudStack API call failed, retrying",
+			"command", command, "attempt", attempt, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > c.retryConfig.MaxBackoff {
+			backoff = c.retryConfig.MaxBackoff
+		}
+	}
+}
+
+// isTransient checks whether an error of a CloudStack API
+// call is transient, i.e. whether the call may be retried.
+func isTransient(err error) bool {
+	if err == cloudstack.AsyncTimeoutErr {
+		// The asynchronous job is still running
+		return true
+	}
+	if errors.Is(err, ErrConcurrentOperation) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// API throttling is transient, unlike the other limits
+		return apiErr.ErrorCode == errorCodeInternalError || apiErr.ErrorCode == errorCodeResourceUnavailable ||
+			apiErr.ErrorCode == errorCodeAPILimitExceeded
+	}
+	// Connection errors and timeouts
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// Responses which are not from CloudStack,
+	// e.g. HTML error pages from a load balancer
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr)
+}
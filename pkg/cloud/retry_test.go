@@ -0,0 +1,178 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"async timeout", cloudstack.AsyncTimeoutErr, true},
+		{"internal error", apiError(errors.New("CloudStack API error 530 (CSExceptionErrorCode: 9999): Internal error executing command")), true},
+		{"resource unavailable", apiError(errors.New("CloudStack API error 534 (CSExceptionErrorCode: 4375): Resource unavailable")), true},
+		{"concurrent operation", apiError(errors.New(`Undefined error: {"cserrorcode":4250,"errorcode":530,"errortext":"There is concurrent operation on the volume"}`)), true},
+		{"invalid parameter", apiError(errors.New("CloudStack API error 431 (CSExceptionErrorCode: 4350): Volume size must be greater than 0")), false},
+		{"API limit", apiError(errors.New("CloudStack API error 429 (CSExceptionErrorCode: 9999): The given user has reached his/her account api limit, please retry after 1000 ms.")), true},
+		{"resource limit", apiError(errors.New("CloudStack API error 532 (CSExceptionErrorCode: 4370): Maximum number of resources of type 'volume' for account has been exceeded.")), false},
+		{"unsupported action", apiError(errors.New("CloudStack API error 432 (CSExceptionErrorCode: 9999): The given command does not exist or it is not available for user")), false},
+		{"not found", ErrNotFound, false},
+		{"network", &timeoutError{}, true},
+		{"other", errors.New("unexpected"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isTransient(c.err); got != c.expected {
+				t.Errorf("isTransient(%v): expected %v, got %v", c.err, c.expected, got)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error.
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+func TestRetry(t *testing.T) {
+	transient := apiError(errors.New("CloudStack API error 530 (CSExceptionErrorCode: 9999): Internal error executing command"))
+	cases := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectError   bool
+	}{
+		{"success", nil, 1, false},
+		{"transient then success", []error{transient, transient}, 3, false},
+		{"too many transient", []error{transient, transient, transient, transient}, 3, true},
+		{"not transient", []error{ErrNotFound, transient}, 1, true},
+	}
+	c := &client{retryConfig: RetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := c.retry(context.Background(), "test", func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tc.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tc.expectedCalls, calls)
+			}
+			if (err != nil) != tc.expectError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	c := &client{retryConfig: RetryConfig{MaxRetries: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := c.retry(ctx, "test", func() error {
+		calls++
+		cancel()
+		return cloudstack.AsyncTimeoutErr
+	})
+	if err != cloudstack.AsyncTimeoutErr {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+// flakyServer is a fake CloudStack API server which
+// fails the first call of each command with an internal error.
+type flakyServer struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	command := req.FormValue("command")
+	s.mu.Lock()
+	s.calls[command]++
+	calls := s.calls[command]
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	var body string
+	switch {
+	case command == "createVolume" || command == "createSnapshot":
+		body = fmt.Sprintf(`{"%sresponse":{"jobid":"job-1"}}`, command)
+	case command == "queryAsyncJobResult":
+		// The job fails, but the volume has been created
+		body = `{"queryasyncjobresultresponse":{"jobid":"job-1","jobstatus":2,"jobresult":{"errorcode":530,"errortext":"Internal error"}}}`
+	case calls == 1 || command == "listSnapshots":
+		w.WriteHeader(530)
+		body = fmt.Sprintf(`{"%sresponse":{"errorcode":530,"cserrorcode":9999,"errortext":"Internal error"}}`, command)
+	case command == "listVolumes":
+		body = `{"listvolumesresponse":{"count":1,"volume":[{"id":"vol-1","name":"vol"}]}}`
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		body = fmt.Sprintf(`{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+	}
+	fmt.Fprint(w, body)
+}
+
+func TestRetryAPI(t *testing.T) {
+	s := &flakyServer{calls: make(map[string]int)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL, Retry: RetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}})
+	ctx := context.Background()
+
+	vol, err := c.GetVolumeByID(ctx, "vol-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vol.ID != "vol-1" {
+		t.Errorf("Unexpected volume %v", vol)
+	}
+	if s.calls["listVolumes"] != 2 {
+		t.Errorf("Expected 2 listVolumes calls, got %d", s.calls["listVolumes"])
+	}
+
+	volumeID, err := c.CreateVolume(ctx, "offering-1", "zone-1", "vol", 1, 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if volumeID != "vol-1" {
+		t.Errorf("Expected the existing volume vol-1, got %q", volumeID)
+	}
+	if s.calls["createVolume"] != 1 {
+		t.Errorf("Expected 1 createVolume call, got %d", s.calls["createVolume"])
+	}
+	if s.calls["listVolumes"] != 3 {
+		t.Errorf("Expected 3 listVolumes calls, got %d", s.calls["listVolumes"])
+	}
+
+	// Snapshot lookups always fail: the lookups before the retries
+	// are part of the attempts, and are not retried themselves
+	if _, err := c.CreateSnapshot(ctx, "vol-1", "snap"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if s.calls["createSnapshot"] != 1 {
+		t.Errorf("Expected 1 createSnapshot call, got %d", s.calls["createSnapshot"])
+	}
+	if s.calls["listSnapshots"] != 2 {
+		t.Errorf("Expected 2 listSnapshots calls, got %d", s.calls["listSnapshots"])
+	}
+}
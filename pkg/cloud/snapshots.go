@@ -0,0 +1,179 @@
+package cloud
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+)
+
+// cloudStackTimeLayout is the layout used by CloudStack
+// to format dates in API responses.
+const cloudStackTimeLayout = "2006-01-02T15:04:05-0700"
+
+func (c *client) GetSnapshotByID(ctx context.Context, snapshotID string) (*Snapshot, error) {
+	p := c.Snapshot.NewListSnapshotsParams()
+	p.SetId(snapshotID)
+	params := map[string]string{
+		"id": snapshotID,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListSnapshots", "params", params)
+	var l *cloudstack.ListSnapshotsResponse
+	err := c.retry(ctx, "ListSnapshots", func() error {
+		var err error
+		l, err = c.Snapshot.ListSnapshots(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l.Count == 0 {
+		return nil, ErrNotFound
+	}
+	if l.Count > 1 {
+		return nil, ErrTooManyResults
+	}
+	return toSnapshot(l.Snapshots[0]), nil
+}
+
+func (c *client) GetSnapshotByName(ctx context.Context, name string) (*Snapshot, error) {
+	p := c.Snapshot.NewListSnapshotsParams()
+	p.SetName(name)
+	params := map[string]string{
+		"name": name,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListSnapshots", "params", params)
+	var l *cloudstack.ListSnapshotsResponse
+	err := c.retry(ctx, "ListSnapshots", func() error {
+		var err error
+		l, err = c.Snapshot.ListSnapshots(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l.Count == 0 {
+		return nil, ErrNotFound
+	}
+	if l.Count > 1 {
+		return nil, ErrTooManyResults
+	}
+	return toSnapshot(l.Snapshots[0]), nil
+}
+
+func (c *client) ListSnapshots(ctx context.Context, volumeID string) ([]Snapshot, error) {
+	p := c.Snapshot.NewListSnapshotsParams()
+	params := map[string]string{}
+	if volumeID != "" {
+		p.SetVolumeid(volumeID)
+		params["volumeid"] = volumeID
+	}
+	c.setProjectID(p, params)
+	p.SetPagesize(listPageSize)
+	params["pagesize"] = strconv.Itoa(listPageSize)
+	result := []Snapshot{}
+	for page := 1; ; page++ {
+		p.SetPage(page)
+		params["page"] = strconv.Itoa(page)
+		ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListSnapshots", "params", params)
+		var l *cloudstack.ListSnapshotsResponse
+		err := c.retry(ctx, "ListSnapshots", func() error {
+			var err error
+			l, err = c.Snapshot.ListSnapshots(p)
+			return apiError(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, snap := range l.Snapshots {
+			result = append(result, *toSnapshot(snap))
+		}
+		if len(l.Snapshots) == 0 || len(result) >= l.Count {
+			return result, nil
+		}
+	}
+}
+
+func (c *client) CreateSnapshot(ctx context.Context, volumeID, name string) (*Snapshot, error) {
+	p := c.Snapshot.NewCreateSnapshotParams(volumeID)
+	p.SetName(name)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "CreateSnapshot", "params", map[string]string{
+		"volumeid": volumeID,
+		"name":     name,
+	})
+	lp := c.Snapshot.NewListSnapshotsParams()
+	lp.SetName(name)
+	params := map[string]string{
+		"name": name,
+	}
+	c.setProjectID(lp, params)
+
+	var snapshot *Snapshot
+	retried := false
+	err := c.retry(ctx, "CreateSnapshot", func() error {
+		if retried {
+			// The failed attempt may have created the snapshot. The
+			// lookup is part of the attempt: it is not retried itself.
+			ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListSnapshots", "params", params)
+			l, err := c.Snapshot.ListSnapshots(lp)
+			if err != nil {
+				return apiError(err)
+			}
+			if l.Count > 1 {
+				return ErrTooManyResults
+			}
+			if l.Count == 1 {
+				snapshot = toSnapshot(l.Snapshots[0])
+				return nil
+			}
+		}
+		retried = true
+		snap, err := c.Snapshot.CreateSnapshot(p)
+		if err != nil {
+			return apiError(err)
+		}
+		snapshot = toSnapshot((*cloudstack.Snapshot)(snap))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (c *client) DeleteSnapshot(ctx context.Context, id string) error {
+	p := c.Snapshot.NewDeleteSnapshotParams(id)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "DeleteSnapshot", "params", map[string]string{
+		"id": id,
+	})
+	return c.retry(ctx, "DeleteSnapshot", func() error {
+		_, err := c.Snapshot.DeleteSnapshot(p)
+		return apiError(err)
+	})
+}
+
+func toSnapshot(snap *cloudstack.Snapshot) *Snapshot {
+	return &Snapshot{
+		ID:        snap.Id,
+		Name:      snap.Name,
+		Size:      snap.Virtualsize,
+		VolumeID:  snap.Volumeid,
+		ZoneID:    snap.Zoneid,
+		State:     snap.State,
+		CreatedAt: parseTime(snap.Created),
+	}
+}
+
+// parseTime parses a date returned by CloudStack.
+// It returns the zero time if the date cannot be parsed.
+func parseTime(s string) time.Time {
+	t, err := time.Parse(cloudStackTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,93 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// snapshotsServer is a fake CloudStack API server which lists
+// a snapshot named snap, and two snapshots named dup.
+type snapshotsServer struct{}
+
+func (snapshotsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body string
+	switch command := req.FormValue("command"); command {
+	case "listSnapshots":
+		switch req.FormValue("name") {
+		case "snap":
+			body = `{"listsnapshotsresponse":{"count":1,"snapshot":[{"id":"snap-1","name":"snap","volumeid":"vol-1","zoneid":"zone-1","virtualsize":1073741824,"state":"BackedUp","created":"2021-08-02T09:15:00+0200"}]}}`
+		case "dup":
+			body = `{"listsnapshotsresponse":{"count":2,"snapshot":[{"id":"snap-2","name":"dup"},{"id":"snap-3","name":"dup"}]}}`
+		default:
+			body = `{"listsnapshotsresponse":{}}`
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		body = fmt.Sprintf(`{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, body)
+}
+
+func TestGetSnapshotByName(t *testing.T) {
+	server := httptest.NewServer(snapshotsServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	snap, err := c.GetSnapshotByName(ctx, "snap")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Snapshot{
+		ID:        "snap-1",
+		Name:      "snap",
+		Size:      1073741824,
+		VolumeID:  "vol-1",
+		ZoneID:    "zone-1",
+		State:     SnapshotStateBackedUp,
+		CreatedAt: time.Date(2021, 8, 2, 7, 15, 0, 0, time.UTC),
+	}
+	if !snap.CreatedAt.Equal(expected.CreatedAt) {
+		t.Errorf("Expected creation time %v, got %v", expected.CreatedAt, snap.CreatedAt)
+	}
+	snap.CreatedAt = expected.CreatedAt
+	if *snap != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *snap)
+	}
+
+	if _, err := c.GetSnapshotByName(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if _, err := c.GetSnapshotByName(ctx, "dup"); !errors.Is(err, ErrTooManyResults) {
+		t.Errorf("Expected %v, got %v", ErrTooManyResults, err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	if parsed := parseTime("2021-08-02T09:15:00+0200"); !parsed.Equal(time.Date(2021, 8, 2, 7, 15, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected time %v", parsed)
+	}
+	if parsed := parseTime("invalid"); !parsed.IsZero() {
+		t.Errorf("Expected the zero time, got %v", parsed)
+	}
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	server := httptest.NewServer(deleteServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	if err := c.DeleteSnapshot(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if err := c.DeleteSnapshot(ctx, "vol-attached"); errors.Is(err, ErrNotFound) || !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Expected %v, got %v", ErrInvalidParameter, err)
+	}
+}
@@ -0,0 +1,65 @@
+package cloud
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+)
+
+// resourceTypeVolume is the CloudStack resource type of volumes.
+const resourceTypeVolume = "Volume"
+
+func (c *client) TagVolume(ctx context.Context, vol *Volume, tags map[string]string) error {
+	missing := missingTags(vol.Tags, tags)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	retried := false
+	return c.retry(ctx, "CreateTags", func() error {
+		if retried {
+			// CloudStack fails to create a tag which exists, e.g. created
+			// by the failed attempt: the volume is looked up again.
+			current, err := c.lookupVolume(ctx, vol.ID)
+			if err != nil {
+				return err
+			}
+			missing = missingTags(current.Tags, tags)
+			if len(missing) == 0 {
+				return nil
+			}
+		}
+		retried = true
+		p := c.Resourcetags.NewCreateTagsParams([]string{vol.ID}, resourceTypeVolume, missing)
+		ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "CreateTags", "params", map[string]string{
+			"resourceids":  vol.ID,
+			"resourcetype": resourceTypeVolume,
+			"tags":         formatTags(missing),
+		})
+		_, err := c.Resourcetags.CreateTags(p)
+		return apiError(err)
+	})
+}
+
+// missingTags returns the tags whose key is not in existing.
+func missingTags(existing, tags map[string]string) map[string]string {
+	missing := make(map[string]string)
+	for key, value := range tags {
+		if _, ok := existing[key]; !ok {
+			missing[key] = value
+		}
+	}
+	return missing
+}
+
+// formatTags formats tags as a sorted list of key=value, for logging.
+func formatTags(tags map[string]string) string {
+	list := make([]string, 0, len(tags))
+	for key, value := range tags {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
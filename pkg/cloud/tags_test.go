@@ -0,0 +1,105 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMissingTags(t *testing.T) {
+	existing := map[string]string{"a": "1", "b": "2"}
+	tags := map[string]string{"a": "other", "c": "3"}
+	expected := map[string]string{"c": "3"}
+	if missing := missingTags(existing, tags); !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Expected %v, got %v", expected, missing)
+	}
+}
+
+// tagsRecorder is a fake CloudStack API server with a volume which
+// has the tag a=1, and which records created tags and volume lookups.
+// The first createTags calls fail while failures is positive.
+type tagsRecorder struct {
+	mu       sync.Mutex
+	created  []string
+	lookups  int
+	failures int
+}
+
+func (r *tagsRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body string
+	switch command := req.FormValue("command"); command {
+	case "listVolumes":
+		r.mu.Lock()
+		r.lookups++
+		r.mu.Unlock()
+		body = `{"listvolumesresponse":{"count":1,"volume":[{"id":"vol-1","name":"vol","tags":[{"key":"a","value":"1"}]}]}}`
+	case "createTags":
+		r.mu.Lock()
+		if r.failures > 0 {
+			r.failures--
+			r.mu.Unlock()
+			w.WriteHeader(530)
+			body = `{"createtagsresponse":{"errorcode":530,"cserrorcode":9999,"errortext":"Internal error"}}`
+			break
+		}
+		for i := 0; req.FormValue(fmt.Sprintf("tags[%d].key", i)) != ""; i++ {
+			r.created = append(r.created, req.FormValue(fmt.Sprintf("tags[%d].key", i))+"="+req.FormValue(fmt.Sprintf("tags[%d].value", i)))
+		}
+		r.mu.Unlock()
+		body = `{"createtagsresponse":{"jobid":"job-1"}}`
+	case "queryAsyncJobResult":
+		body = `{"queryasyncjobresultresponse":{"jobid":"job-1","jobstatus":1,"jobresult":{"success":true}}}`
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		body = fmt.Sprintf(`{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, body)
+}
+
+func TestTagVolume(t *testing.T) {
+	r := &tagsRecorder{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL, Retry: RetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}})
+	ctx := context.Background()
+	vol := &Volume{ID: "vol-1", Tags: map[string]string{"a": "1"}}
+
+	// The tags of the given volume are used: it is not looked up
+	if err := c.TagVolume(ctx, vol, map[string]string{"a": "2", "b": "3"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"b=3"}
+	if !reflect.DeepEqual(r.created, expected) {
+		t.Errorf("Expected created tags %v, got %v", expected, r.created)
+	}
+	if r.lookups != 0 {
+		t.Errorf("Expected no volume lookup, got %d", r.lookups)
+	}
+
+	// All tags exist: nothing to create
+	r.created = nil
+	if err := c.TagVolume(ctx, vol, map[string]string{"a": "1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(r.created) != 0 {
+		t.Errorf("Expected no created tags, got %v", r.created)
+	}
+
+	// The volume is looked up again before a retry
+	r.failures = 1
+	if err := c.TagVolume(ctx, vol, map[string]string{"b": "3"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(r.created, expected) {
+		t.Errorf("Expected created tags %v, got %v", expected, r.created)
+	}
+	if r.lookups != 1 {
+		t.Errorf("Expected 1 volume lookup, got %d", r.lookups)
+	}
+}
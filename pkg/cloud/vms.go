@@ -3,16 +3,37 @@ package cloud
 import (
 	"context"
 
+	"github.com/apache/cloudstack-go/v2/cloudstack"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 )
 
 func (c *client) GetVMByID(ctx context.Context, vmID string) (*VM, error) {
+	if v, ok := c.vmCache.get(vmID); ok {
+		vm := v.(VM)
+		return &vm, nil
+	}
+	vm, err := c.getVMByID(ctx, vmID)
+	if err != nil {
+		return nil, err
+	}
+	c.vmCache.set(vmID, *vm)
+	return vm, nil
+}
+
+func (c *client) getVMByID(ctx context.Context, vmID string) (*VM, error) {
 	p := c.VirtualMachine.NewListVirtualMachinesParams()
 	p.SetId(vmID)
-	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVirtualMachines", "params", map[string]string{
+	params := map[string]string{
 		"id": vmID,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVirtualMachines", "params", params)
+	var l *cloudstack.ListVirtualMachinesResponse
+	err := c.retry(ctx, "ListVirtualMachines", func() error {
+		var err error
+		l, err = c.VirtualMachine.ListVirtualMachines(p)
+		return apiError(err)
 	})
-	l, err := c.VirtualMachine.ListVirtualMachines(p)
 	if err != nil {
 		return nil, err
 	}
@@ -24,18 +45,27 @@ func (c *client) GetVMByID(ctx context.Context, vmID string) (*VM, error) {
 	}
 	vm := l.VirtualMachines[0]
 	return &VM{
-		ID:     vm.Id,
-		ZoneID: vm.Zoneid,
+		ID:         vm.Id,
+		ZoneID:     vm.Zoneid,
+		HostID:     vm.Hostid,
+		Hypervisor: vm.Hypervisor,
 	}, nil
 }
 
 func (c *client) getVMByName(ctx context.Context, name string) (*VM, error) {
 	p := c.VirtualMachine.NewListVirtualMachinesParams()
 	p.SetName(name)
-	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVirtualMachines", "params", map[string]string{
+	params := map[string]string{
 		"name": name,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVirtualMachines", "params", params)
+	var l *cloudstack.ListVirtualMachinesResponse
+	err := c.retry(ctx, "ListVirtualMachines", func() error {
+		var err error
+		l, err = c.VirtualMachine.ListVirtualMachines(p)
+		return apiError(err)
 	})
-	l, err := c.VirtualMachine.ListVirtualMachines(p)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +77,38 @@ func (c *client) getVMByName(ctx context.Context, name string) (*VM, error) {
 	}
 	vm := l.VirtualMachines[0]
 	return &VM{
-		ID:     vm.Id,
-		ZoneID: vm.Zoneid,
+		ID:         vm.Id,
+		ZoneID:     vm.Zoneid,
+		HostID:     vm.Hostid,
+		Hypervisor: vm.Hypervisor,
 	}, nil
 }
+
+func (c *client) GetMaxDataVolumes(ctx context.Context, hypervisor string) (int, error) {
+	p := c.Hypervisor.NewListHypervisorCapabilitiesParams()
+	p.SetHypervisor(hypervisor)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListHypervisorCapabilities", "params", map[string]string{
+		"hypervisor": hypervisor,
+	})
+	var l *cloudstack.ListHypervisorCapabilitiesResponse
+	err := c.retry(ctx, "ListHypervisorCapabilities", func() error {
+		var err error
+		l, err = c.Hypervisor.ListHypervisorCapabilities(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if l.Count == 0 {
+		return 0, ErrNotFound
+	}
+	// The hypervisor version of the host is not known:
+	// use the most restrictive limit of all versions.
+	limit := l.HypervisorCapabilities[0].Maxdatavolumeslimit
+	for _, capability := range l.HypervisorCapabilities[1:] {
+		if capability.Maxdatavolumeslimit < limit {
+			limit = capability.Maxdatavolumeslimit
+		}
+	}
+	return limit, nil
+}
@@ -2,19 +2,31 @@ package cloud
 
 import (
 	"context"
+	"errors"
 	"strconv"
-	"strings"
 
+	"github.com/apache/cloudstack-go/v2/cloudstack"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 )
 
+// dataDiskType is the CloudStack type of the volumes
+// which are not root disks of virtual machines.
+const dataDiskType = "DATADISK"
+
 func (c *client) GetVolumeByID(ctx context.Context, volumeID string) (*Volume, error) {
 	p := c.Volume.NewListVolumesParams()
 	p.SetId(volumeID)
-	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", map[string]string{
+	params := map[string]string{
 		"id": volumeID,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+	var l *cloudstack.ListVolumesResponse
+	err := c.retry(ctx, "ListVolumes", func() error {
+		var err error
+		l, err = c.Volume.ListVolumes(p)
+		return apiError(err)
 	})
-	l, err := c.Volume.ListVolumes(p)
 	if err != nil {
 		return nil, err
 	}
@@ -24,26 +36,46 @@ func (c *client) GetVolumeByID(ctx context.Context, volumeID string) (*Volume, e
 	if l.Count > 1 {
 		return nil, ErrTooManyResults
 	}
-	vol := l.Volumes[0]
-	v := Volume{
-		ID:               vol.Id,
-		Name:             vol.Name,
-		Size:             vol.Size,
-		DiskOfferingID:   vol.Diskofferingid,
-		ZoneID:           vol.Zoneid,
-		VirtualMachineID: vol.Virtualmachineid,
-		DeviceID:         strconv.FormatInt(vol.Deviceid, 10),
+	return toVolume(l.Volumes[0]), nil
+}
+
+// lookupVolume looks a volume up by ID within an attempt of another
+// call: unlike GetVolumeByID, it is neither retried nor rate-limited.
+func (c *client) lookupVolume(ctx context.Context, volumeID string) (*Volume, error) {
+	p := c.Volume.NewListVolumesParams()
+	p.SetId(volumeID)
+	params := map[string]string{
+		"id": volumeID,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+	l, err := c.Volume.ListVolumes(p)
+	if err != nil {
+		return nil, apiError(err)
+	}
+	if l.Count == 0 {
+		return nil, ErrNotFound
+	}
+	if l.Count > 1 {
+		return nil, ErrTooManyResults
 	}
-	return &v, nil
+	return toVolume(l.Volumes[0]), nil
 }
 
 func (c *client) GetVolumeByName(ctx context.Context, name string) (*Volume, error) {
 	p := c.Volume.NewListVolumesParams()
 	p.SetName(name)
-	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", map[string]string{
+	params := map[string]string{
 		"name": name,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+	var l *cloudstack.ListVolumesResponse
+	err := c.retry(ctx, "ListVolumes", func() error {
+		var err error
+		l, err = c.Volume.ListVolumes(p)
+		return apiError(err)
 	})
-	l, err := c.Volume.ListVolumes(p)
 	if err != nil {
 		return nil, err
 	}
@@ -53,36 +85,159 @@ func (c *client) GetVolumeByName(ctx context.Context, name string) (*Volume, err
 	if l.Count > 1 {
 		return nil, ErrTooManyResults
 	}
-	vol := l.Volumes[0]
-	v := Volume{
-		ID:               vol.Id,
-		Name:             vol.Name,
-		Size:             vol.Size,
-		DiskOfferingID:   vol.Diskofferingid,
-		ZoneID:           vol.Zoneid,
-		VirtualMachineID: vol.Virtualmachineid,
-		DeviceID:         strconv.FormatInt(vol.Deviceid, 10),
+	return toVolume(l.Volumes[0]), nil
+}
+
+func (c *client) ListVolumes(ctx context.Context, tags map[string]string, page, pageSize int) ([]Volume, int, error) {
+	p := c.Volume.NewListVolumesParams()
+	p.SetType(dataDiskType)
+	p.SetPage(page)
+	p.SetPagesize(pageSize)
+	params := map[string]string{
+		"type":     dataDiskType,
+		"page":     strconv.Itoa(page),
+		"pagesize": strconv.Itoa(pageSize),
+	}
+	if len(tags) > 0 {
+		p.SetTags(tags)
+		params["tags"] = formatTags(tags)
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+	var l *cloudstack.ListVolumesResponse
+	err := c.retry(ctx, "ListVolumes", func() error {
+		var err error
+		l, err = c.Volume.ListVolumes(p)
+		return apiError(err)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]Volume, 0, len(l.Volumes))
+	for _, vol := range l.Volumes {
+		result = append(result, *toVolume(vol))
+	}
+	return result, l.Count, nil
+}
+
+func (c *client) ListVolumesByVM(ctx context.Context, vmID string) ([]Volume, error) {
+	p := c.Volume.NewListVolumesParams()
+	p.SetType(dataDiskType)
+	p.SetVirtualmachineid(vmID)
+	params := map[string]string{
+		"type":             dataDiskType,
+		"virtualmachineid": vmID,
+	}
+	c.setProjectID(p, params)
+	p.SetPagesize(listPageSize)
+	params["pagesize"] = strconv.Itoa(listPageSize)
+	result := []Volume{}
+	for page := 1; ; page++ {
+		p.SetPage(page)
+		params["page"] = strconv.Itoa(page)
+		ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+		var l *cloudstack.ListVolumesResponse
+		err := c.retry(ctx, "ListVolumes", func() error {
+			var err error
+			l, err = c.Volume.ListVolumes(p)
+			return apiError(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, vol := range l.Volumes {
+			result = append(result, *toVolume(vol))
+		}
+		if len(l.Volumes) == 0 || len(result) >= l.Count {
+			return result, nil
+		}
 	}
-	return &v, nil
 }
 
-func (c *client) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB int64) (string, error) {
+func (c *client) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB, minIOPS, maxIOPS int64) (string, error) {
 	p := c.Volume.NewCreateVolumeParams()
 	p.SetDiskofferingid(diskOfferingID)
 	p.SetZoneid(zoneID)
 	p.SetName(name)
-	p.SetSize(sizeInGB)
-	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "CreateVolume", "params", map[string]string{
+	params := map[string]string{
 		"diskofferingid": diskOfferingID,
 		"zoneid":         zoneID,
 		"name":           name,
-		"size":           strconv.FormatInt(sizeInGB, 10),
-	})
-	vol, err := c.Volume.CreateVolume(p)
-	if err != nil {
-		return "", err
 	}
-	return vol.Id, nil
+	if sizeInGB > 0 {
+		// CloudStack rejects a size for fixed-size disk offerings
+		p.SetSize(sizeInGB)
+		params["size"] = strconv.FormatInt(sizeInGB, 10)
+	}
+	if minIOPS > 0 {
+		p.SetMiniops(minIOPS)
+		params["miniops"] = strconv.FormatInt(minIOPS, 10)
+	}
+	if maxIOPS > 0 {
+		p.SetMaxiops(maxIOPS)
+		params["maxiops"] = strconv.FormatInt(maxIOPS, 10)
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "CreateVolume", "params", params)
+	volumeID, err := c.createVolume(ctx, p, name)
+	if errors.Is(err, ErrNotFound) {
+		// The zone may have been removed
+		c.invalidateZones()
+	}
+	return volumeID, err
+}
+
+func (c *client) CreateVolumeFromSnapshot(ctx context.Context, snapshotID, name string) (string, error) {
+	p := c.Volume.NewCreateVolumeParams()
+	p.SetSnapshotid(snapshotID)
+	p.SetName(name)
+	params := map[string]string{
+		"snapshotid": snapshotID,
+		"name":       name,
+	}
+	c.setProjectID(p, params)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "CreateVolume", "params", params)
+	return c.createVolume(ctx, p, name)
+}
+
+// createVolume creates a volume, retrying transient failures.
+// Before a retry, it looks the volume up by name in case the failed
+// attempt actually created it. The lookup is part of the attempt:
+// it is neither retried nor rate-limited on its own.
+func (c *client) createVolume(ctx context.Context, p *cloudstack.CreateVolumeParams, name string) (string, error) {
+	lp := c.Volume.NewListVolumesParams()
+	lp.SetName(name)
+	params := map[string]string{
+		"name": name,
+	}
+	c.setProjectID(lp, params)
+
+	var volumeID string
+	retried := false
+	err := c.retry(ctx, "CreateVolume", func() error {
+		if retried {
+			ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListVolumes", "params", params)
+			l, err := c.Volume.ListVolumes(lp)
+			if err != nil {
+				return apiError(err)
+			}
+			if l.Count > 1 {
+				return ErrTooManyResults
+			}
+			if l.Count == 1 {
+				volumeID = l.Volumes[0].Id
+				return nil
+			}
+		}
+		retried = true
+		vol, err := c.Volume.CreateVolume(p)
+		if err != nil {
+			return apiError(err)
+		}
+		volumeID = vol.Id
+		return nil
+	})
+	return volumeID, err
 }
 
 func (c *client) DeleteVolume(ctx context.Context, id string) error {
@@ -90,12 +245,25 @@ func (c *client) DeleteVolume(ctx context.Context, id string) error {
 	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "DeleteVolume", "params", map[string]string{
 		"id": id,
 	})
-	_, err := c.Volume.DeleteVolume(p)
-	if err != nil && strings.Contains(err.Error(), "4350") {
-		// CloudStack error InvalidParameterValueException
-		return ErrNotFound
-	}
-	return err
+	return c.retry(ctx, "DeleteVolume", func() error {
+		_, err := c.Volume.DeleteVolume(p)
+		return apiError(err)
+	})
+}
+
+func (c *client) ResizeVolume(ctx context.Context, volumeID string, sizeInGB int64) error {
+	p := c.Volume.NewResizeVolumeParams(volumeID)
+	p.SetSize(sizeInGB)
+	p.SetShrinkok(false)
+	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ResizeVolume", "params", map[string]string{
+		"id":       volumeID,
+		"size":     strconv.FormatInt(sizeInGB, 10),
+		"shrinkok": "false",
+	})
+	return c.retry(ctx, "ResizeVolume", func() error {
+		_, err := c.Volume.ResizeVolume(p)
+		return apiError(err)
+	})
 }
 
 func (c *client) AttachVolume(ctx context.Context, volumeID, vmID string) (string, error) {
@@ -104,11 +272,33 @@ func (c *client) AttachVolume(ctx context.Context, volumeID, vmID string) (strin
 		"id":               volumeID,
 		"virtualmachineid": vmID,
 	})
-	r, err := c.Volume.AttachVolume(p)
-	if err != nil {
-		return "", err
+	var deviceID string
+	retried := false
+	err := c.retry(ctx, "AttachVolume", func() error {
+		if retried {
+			// The failed attempt may have attached the volume
+			vol, err := c.lookupVolume(ctx, volumeID)
+			if err != nil {
+				return err
+			}
+			if vol.VirtualMachineID == vmID {
+				deviceID = vol.DeviceID
+				return nil
+			}
+		}
+		retried = true
+		r, err := c.Volume.AttachVolume(p)
+		if err != nil {
+			return apiError(err)
+		}
+		deviceID = strconv.FormatInt(r.Deviceid, 10)
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		// The VM may have been removed
+		c.invalidateVM(vmID)
 	}
-	return strconv.FormatInt(r.Deviceid, 10), nil
+	return deviceID, err
 }
 
 func (c *client) DetachVolume(ctx context.Context, volumeID string) error {
@@ -117,6 +307,46 @@ func (c *client) DetachVolume(ctx context.Context, volumeID string) error {
 	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "DetachVolume", "params", map[string]string{
 		"id": volumeID,
 	})
-	_, err := c.Volume.DetachVolume(p)
-	return err
+	retried := false
+	return c.retry(ctx, "DetachVolume", func() error {
+		if retried {
+			// The failed attempt may have detached the volume
+			vol, err := c.lookupVolume(ctx, volumeID)
+			if err != nil {
+				return err
+			}
+			if vol.VirtualMachineID == "" {
+				return nil
+			}
+		}
+		retried = true
+		_, err := c.Volume.DetachVolume(p)
+		return apiError(err)
+	})
+}
+
+func toVolume(vol *cloudstack.Volume) *Volume {
+	return &Volume{
+		ID:               vol.Id,
+		Name:             vol.Name,
+		Size:             vol.Size,
+		DiskOfferingID:   vol.Diskofferingid,
+		ZoneID:           vol.Zoneid,
+		VirtualMachineID: vol.Virtualmachineid,
+		DeviceID:         strconv.FormatInt(vol.Deviceid, 10),
+		SnapshotID:       vol.Snapshotid,
+		State:            vol.State,
+		MinIOPS:          vol.Miniops,
+		MaxIOPS:          vol.Maxiops,
+		Tags:             toTags(vol.Tags),
+		CreatedAt:        parseTime(vol.Created),
+	}
+}
+
+func toTags(tags []cloudstack.Tags) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		result[tag.Key] = tag.Value
+	}
+	return result
 }
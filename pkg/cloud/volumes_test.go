@@ -0,0 +1,149 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deleteServer is a fake CloudStack API server where the resource
+// vol-attached cannot be deleted, and no other resource exists.
+type deleteServer struct{}
+
+func (deleteServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	command := req.FormValue("command")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(431)
+	switch {
+	case command != "deleteVolume" && command != "deleteSnapshot":
+		fmt.Fprintf(w, `{"errorresponse":{"errorcode":431,"errortext":"unexpected command %s"}}`, command)
+	case req.FormValue("id") == "vol-attached":
+		fmt.Fprintf(w, `{"%sresponse":{"errorcode":431,"cserrorcode":4350,"errortext":"Please specify a volume that is not attached to any VM."}}`, command)
+	default:
+		fmt.Fprintf(w, `{"%sresponse":{"errorcode":431,"cserrorcode":4350,"errortext":"Unable to execute API command %s due to invalid value. Invalid parameter id value=%s due to incorrect long value format, or entity does not exist or due to incorrect parameter annotation for the field in api cmd class."}}`,
+			command, command, req.FormValue("id"))
+	}
+}
+
+func TestDeleteVolume(t *testing.T) {
+	server := httptest.NewServer(deleteServer{})
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+	ctx := context.Background()
+
+	if err := c.DeleteVolume(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	err := c.DeleteVolume(ctx, "vol-attached")
+	if !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Expected %v, got %v", ErrInvalidParameter, err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("Attached volume reported as not found: %v", err)
+	}
+}
+
+// attachServer is a fake CloudStack API server whose attachment and
+// detachment jobs fail, and whose volume lookups always fail.
+type attachServer struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *attachServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	command := req.FormValue("command")
+	s.mu.Lock()
+	s.calls[command]++
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch command {
+	case "attachVolume", "detachVolume":
+		fmt.Fprintf(w, `{"%sresponse":{"jobid":"job-1"}}`, command)
+	case "queryAsyncJobResult":
+		fmt.Fprint(w, `{"queryasyncjobresultresponse":{"jobid":"job-1","jobstatus":2,"jobresult":{"errorcode":530,"errortext":"Internal error"}}}`)
+	default:
+		w.WriteHeader(530)
+		fmt.Fprintf(w, `{"%sresponse":{"errorcode":530,"cserrorcode":9999,"errortext":"Internal error"}}`, command)
+	}
+}
+
+func TestAttachDetachRetry(t *testing.T) {
+	s := &attachServer{calls: make(map[string]int)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL, Retry: RetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}})
+	ctx := context.Background()
+
+	// The lookups before the retries are part of
+	// the attempts, and are not retried themselves
+	if _, err := c.AttachVolume(ctx, "vol-1", "vm-1"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if s.calls["attachVolume"] != 1 || s.calls["listVolumes"] != 2 {
+		t.Errorf("Expected 1 attachVolume and 2 listVolumes calls, got %v", s.calls)
+	}
+
+	s.calls = make(map[string]int)
+	if err := c.DetachVolume(ctx, "vol-1"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if s.calls["detachVolume"] != 1 || s.calls["listVolumes"] != 2 {
+		t.Errorf("Expected 1 detachVolume and 2 listVolumes calls, got %v", s.calls)
+	}
+}
+
+// listServer is a fake CloudStack API server which
+// records the parameters of the last volumes listing.
+type listServer struct {
+	params map[string]string
+}
+
+func (s *listServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	s.params = make(map[string]string)
+	for key := range req.Form {
+		s.params[key] = req.FormValue(key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"listvolumesresponse":{"count":3,"volume":[{"id":"vol-1"}]}}`)
+}
+
+func TestListVolumes(t *testing.T) {
+	s := &listServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := New(&Config{APIURL: server.URL})
+
+	vols, total, err := c.ListVolumes(context.Background(), map[string]string{"cluster": "cluster-1"}, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || total != 3 {
+		t.Errorf("Expected 1 of 3 volumes, got %d of %d", len(vols), total)
+	}
+	expected := map[string]string{
+		"type":          dataDiskType,
+		"page":          "3",
+		"pagesize":      "1",
+		"tags[0].key":   "cluster",
+		"tags[0].value": "cluster-1",
+	}
+	for key, value := range expected {
+		if s.params[key] != value {
+			t.Errorf("Expected parameter %s=%q, got %q", key, value, s.params[key])
+		}
+	}
+
+	if _, _, err := c.ListVolumes(context.Background(), nil, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.params["tags[0].key"]; ok {
+		t.Errorf("Unexpected tags filter %v", s.params)
+	}
+}
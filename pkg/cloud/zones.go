@@ -3,22 +3,57 @@ package cloud
 import (
 	"context"
 
+	"github.com/apache/cloudstack-go/v2/cloudstack"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 )
 
 func (c *client) ListZonesID(ctx context.Context) ([]string, error) {
+	if v, ok := c.zonesCache.get(""); ok {
+		return append([]string{}, v.([]string)...), nil
+	}
+	zones, err := c.listZonesID(ctx)
+	if err != nil {
+		return zones, err
+	}
+	c.zonesCache.set("", append([]string{}, zones...))
+	return zones, nil
+}
+
+func (c *client) listZonesID(ctx context.Context) ([]string, error) {
 	result := []string{}
 	p := c.Zone.NewListZonesParams()
 	p.SetAvailable(true)
 	ctxzap.Extract(ctx).Sugar().Infow("CloudStack API call", "command", "ListZones", "params", map[string]string{
 		"available": "true",
 	})
-	r, err := c.Zone.ListZones(p)
+	var r *cloudstack.ListZonesResponse
+	err := c.retry(ctx, "ListZones", func() error {
+		var err error
+		r, err = c.Zone.ListZones(p)
+		return apiError(err)
+	})
 	if err != nil {
 		return result, err
 	}
 	for _, zone := range r.Zones {
-		result = append(result, zone.Id)
+		if c.isZoneAllowed(zone) {
+			result = append(result, zone.Id)
+		}
 	}
 	return result, nil
 }
+
+// isZoneAllowed checks whether a zone is in the configured list
+// of zones, given by ID or name. All zones are allowed when no
+// list is configured.
+func (c *client) isZoneAllowed(zone *cloudstack.Zone) bool {
+	if len(c.zones) == 0 {
+		return true
+	}
+	for _, z := range c.zones {
+		if z == zone.Id || z == zone.Name {
+			return true
+		}
+	}
+	return false
+}
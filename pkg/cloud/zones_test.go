@@ -0,0 +1,42 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestListZonesID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"listzonesresponse":{"count":3,"zone":[`+
+			`{"id":"id-1","name":"zone-1"},{"id":"id-2","name":"zone-2"},{"id":"id-3","name":"zone-3"}]}}`)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name     string
+		zones    []string
+		expected []string
+	}{
+		{"all zones", nil, []string{"id-1", "id-2", "id-3"}},
+		{"by ID", []string{"id-2"}, []string{"id-2"}},
+		{"by name", []string{"zone-1", "zone-3"}, []string{"id-1", "id-3"}},
+		{"unknown zone", []string{"zone-4"}, []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := New(&Config{APIURL: server.URL, Zones: c.zones})
+			zones, err := client.ListZonesID(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(zones, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, zones)
+			}
+		})
+	}
+}
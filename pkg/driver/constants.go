@@ -9,9 +9,46 @@ const (
 	HostKey = "topology." + DriverName + "/host"
 )
 
-// Volume parameters keys
+// Volume parameters keys. The disk offering is given
+// either by ID, by name, or by storage tags.
 const (
-	DiskOfferingKey = DriverName + "/disk-offering-id"
+	DiskOfferingKey     = DriverName + "/disk-offering-id"
+	DiskOfferingNameKey = DriverName + "/disk-offering-name"
+	DiskOfferingTagsKey = DriverName + "/disk-offering-tags"
+
+	// IOPS of disk offerings with customized IOPS: the min IOPS
+	// is given either as is or as a ratio to the size in GB.
+	MinIOPSKey   = DriverName + "/min-iops"
+	MaxIOPSKey   = DriverName + "/max-iops"
+	IOPSPerGBKey = DriverName + "/iops-per-gb"
+)
+
+// Parameters added by the external-provisioner
+// when started with --extra-create-metadata.
+const (
+	pvcNameKey      = "csi.storage.k8s.io/pvc/name"
+	pvcNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	pvNameKey       = "csi.storage.k8s.io/pv/name"
+)
+
+// tagParameterPrefix is the prefix of volume parameters
+// giving extra resource tags of volumes.
+const tagParameterPrefix = "tag."
+
+// Keys of the resource tags set on CloudStack volumes.
+const (
+	PVCNameTagKey      = DriverName + "/pvc-name"
+	PVCNamespaceTagKey = DriverName + "/pvc-namespace"
+	PVNameTagKey       = DriverName + "/pv-name"
+	ClusterIDTagKey    = DriverName + "/cluster-id"
 )
 
 const deviceIDContextKey = "deviceID"
+
+// cloneSnapshotPrefix is the name prefix of the transient
+// snapshots used to clone volumes.
+const cloneSnapshotPrefix = "clone-"
+
+// DefaultVolumeNamePrefix is the name prefix given by default
+// by the external-provisioner to the volumes it creates.
+const DefaultVolumeNamePrefix = "pvc-"
@@ -2,12 +2,18 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
 	"github.com/apalia/cloudstack-csi-driver/pkg/util"
@@ -21,120 +27,488 @@ var onlyVolumeCapAccessMode = csi.VolumeCapability_AccessMode{
 	Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 }
 
+// listVolumesPageSize is the CloudStack page size used to list
+// volumes when CloudStack cannot paginate the response itself.
+const listVolumesPageSize = 500
+
 type controllerServer struct {
 	csi.UnimplementedControllerServer
-	connector cloud.Interface
+	connector        cloud.Interface
+	clusterID        string
+	volumeNamePrefix string
+
+	// volumeLocks prevents concurrent operations on a volume
+	volumeLocks *operationLocks
+	// vmLocks serializes attach and detach operations on a VM
+	vmLocks *operationLocks
 }
 
 // NewControllerServer creates a new Controller gRPC server.
-func NewControllerServer(connector cloud.Interface) csi.ControllerServer {
+//
+// If clusterID is not empty, it is set as a resource tag on the volumes
+// it creates, and identifies the volumes it lists. Otherwise, listed
+// volumes are identified by volumeNamePrefix.
+func NewControllerServer(connector cloud.Interface, clusterID, volumeNamePrefix string) csi.ControllerServer {
 	return &controllerServer{
-		connector: connector,
+		connector:        connector,
+		clusterID:        clusterID,
+		volumeNamePrefix: volumeNamePrefix,
+		volumeLocks:      newOperationLocks(),
+		vmLocks:          newOperationLocks(),
 	}
 }
 
 func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	tags, err := volumeTags(req.GetParameters(), cs.clusterID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, vol, err := cs.createVolume(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tags are also added to an existing volume,
+	// in case a previous attempt failed to add them.
+	if vol == nil {
+		// A new volume has no tags yet
+		vol = &cloud.Volume{ID: res.GetVolume().GetVolumeId()}
+	}
+	if err := cs.connector.TagVolume(ctx, vol, tags); err != nil {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot tag volume %v: %v", vol.ID, err)
+	}
+	return res, nil
+}
+
+// createVolume creates the volume, or returns the existing volume
+// suiting the request together with the volume as listed from
+// CloudStack, which is nil if the volume has been created.
+func (cs *controllerServer) createVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, *cloud.Volume, error) {
 
 	// Check arguments
 
 	if req.GetName() == "" {
-		return nil, status.Error(codes.InvalidArgument, "Volume name missing in request")
+		return nil, nil, status.Error(codes.InvalidArgument, "Volume name missing in request")
 	}
 	name := req.GetName()
 
 	volCaps := req.GetVolumeCapabilities()
 	if len(volCaps) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Volume capabilities missing in request")
+		return nil, nil, status.Error(codes.InvalidArgument, "Volume capabilities missing in request")
 	}
 	if !isValidVolumeCapabilities(volCaps) {
-		return nil, status.Error(codes.InvalidArgument, "Volume capabilities not supported. Only SINGLE_NODE_WRITER supported.")
+		return nil, nil, status.Error(codes.InvalidArgument, "Volume capabilities not supported. Only SINGLE_NODE_WRITER supported.")
 	}
 
 	if req.GetParameters() == nil {
-		return nil, status.Error(codes.InvalidArgument, "Volume parameters missing in request")
+		return nil, nil, status.Error(codes.InvalidArgument, "Volume parameters missing in request")
+	}
+	offering, err := cs.diskOffering(ctx, req.GetParameters())
+	if err != nil {
+		return nil, nil, err
+	}
+	if offering == nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Missing parameter %v, %v or %v", DiskOfferingKey, DiskOfferingNameKey, DiskOfferingTagsKey)
+	}
+	diskOfferingID := offering.ID
+
+	iops, err := parseVolumeIOPS(req.GetParameters())
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Check the volume content source
+	var snapshotID string
+	var sourceVolume *cloud.Volume
+	if src := req.GetVolumeContentSource(); src != nil {
+		switch src.GetType().(type) {
+		case *csi.VolumeContentSource_Snapshot:
+			snapshotID = src.GetSnapshot().GetSnapshotId()
+			if snapshotID == "" {
+				return nil, nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in volume content source")
+			}
+		case *csi.VolumeContentSource_Volume:
+			sourceVolumeID := src.GetVolume().GetVolumeId()
+			if sourceVolumeID == "" {
+				return nil, nil, status.Error(codes.InvalidArgument, "Volume ID missing in volume content source")
+			}
+			sourceVolume, err = cs.connector.GetVolumeByID(ctx, sourceVolumeID)
+			if errors.Is(err, cloud.ErrNotFound) {
+				return nil, nil, status.Errorf(codes.NotFound, "Source volume %v not found", sourceVolumeID)
+			} else if err != nil {
+				// Error with CloudStack
+				return nil, nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+			}
+			// A clone has the disk offering of its source volume
+			diskOfferingID = sourceVolume.DiskOfferingID
+		default:
+			return nil, nil, status.Error(codes.InvalidArgument, "Unsupported volume content source")
+		}
+		// Volumes created from a snapshot or cloned get the IOPS
+		// of their disk offering: IOPS parameters are ignored.
+		iops = volumeIOPS{}
 	}
-	diskOfferingID := req.GetParameters()[DiskOfferingKey]
-	if diskOfferingID == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "Missing parameter %v", DiskOfferingKey)
+	if iops.isSet() && !offering.CustomizedIOPS {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Disk offering %v does not have customized IOPS", offering.Name)
 	}
 
 	// Check if a volume with that name already exists
-	if vol, err := cs.connector.GetVolumeByName(ctx, name); err == cloud.ErrNotFound {
+	if vol, err := cs.connector.GetVolumeByName(ctx, name); errors.Is(err, cloud.ErrNotFound) {
 		// The volume does not exist
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "CloudStack error: %v", err)
+		return nil, nil, status.Errorf(cloudErrorCode(err), "CloudStack error: %v", err)
 	} else {
 		// The volume exists. Check if it suits the request.
-		if ok, message := checkVolumeSuitable(vol, diskOfferingID, req.GetCapacityRange(), req.GetAccessibilityRequirements()); !ok {
-			return nil, status.Errorf(codes.AlreadyExists, "Volume %v already exists but does not satisfy request: %s", name, message)
+		if ok, message := checkVolumeSuitable(vol, diskOfferingID, snapshotID, iops, req.GetCapacityRange(), req.GetAccessibilityRequirements()); !ok {
+			return nil, nil, status.Errorf(codes.AlreadyExists, "Volume %v already exists but does not satisfy request: %s", name, message)
 		}
 		// Existing volume is ok
+		volOffering, err := cs.diskOfferingByID(ctx, offering, vol.DiskOfferingID)
+		if err != nil {
+			return nil, nil, err
+		}
+		topology, err := volumeTopology(vol.ZoneID, volOffering, req.GetAccessibilityRequirements())
+		if err != nil {
+			return nil, nil, err
+		}
 		return &csi.CreateVolumeResponse{
 			Volume: &csi.Volume{
-				VolumeId:      vol.ID,
-				CapacityBytes: vol.Size,
-				AccessibleTopology: []*csi.Topology{
-					Topology{ZoneID: vol.ZoneID}.ToCSI(),
-				},
+				VolumeId:           vol.ID,
+				CapacityBytes:      vol.Size,
+				ContentSource:      req.GetVolumeContentSource(),
+				AccessibleTopology: []*csi.Topology{topology},
 			},
-		}, nil
+		}, vol, nil
 	}
 
 	// We have to create the volume
 
-	// Determine volume size using requested capacity range
-	sizeInGB, err := determineSize(req)
-	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+	if snapshotID != "" {
+		res, err := cs.createVolumeFromSnapshot(ctx, req, snapshotID, offering)
+		return res, nil, err
+	}
+	if sourceVolume != nil {
+		res, err := cs.createVolumeFromVolume(ctx, req, sourceVolume, offering)
+		return res, nil, err
 	}
 
-	// Determine zone using topology constraints
-	var zoneID string
-	topologyRequirement := req.GetAccessibilityRequirements()
-	if topologyRequirement == nil || topologyRequirement.GetRequisite() == nil {
-		// No topology requirement. Use random zone
-		zones, err := cs.connector.ListZonesID(ctx)
+	// Determine volume size using requested capacity range,
+	// unless the disk offering has a fixed size
+	var sizeInGB, capacity int64
+	if offering.Customized {
+		sizeInGB, err = determineSize(req)
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, err.Error())
-		}
-		n := len(zones)
-		if n == 0 {
-			return nil, status.Error(codes.Internal, "No zone available")
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
 		}
-		zoneID = zones[rand.Intn(n)]
+		capacity = util.GigaBytesToBytes(sizeInGB)
 	} else {
-		reqTopology := topologyRequirement.GetRequisite()
-		if len(reqTopology) > 1 {
-			return nil, status.Error(codes.InvalidArgument, "Too many topology requirements")
+		if err := checkFixedSize(offering.Size, req.GetCapacityRange()); err != nil {
+			return nil, nil, status.Errorf(codes.OutOfRange, "Disk offering %v: %v", offering.Name, err)
 		}
-		t, err := NewTopology(reqTopology[0])
+		capacity = offering.Size
+	}
+
+	// Determine zone using topology constraints
+	zones, err := cs.connector.ListZonesID(ctx)
+	if err != nil {
+		return nil, nil, status.Errorf(cloudErrorCode(err), "Cannot list zones: %v", err)
+	}
+	zoneID, err := selectZone(zones, req.GetAccessibilityRequirements())
+	if err != nil {
+		return nil, nil, err
+	}
+	topology, err := volumeTopology(zoneID, offering, req.GetAccessibilityRequirements())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	minIOPS, maxIOPS := iops.forSize(util.RoundUpBytesToGB(capacity))
+	volID, err := cs.connector.CreateVolume(ctx, diskOfferingID, zoneID, name, sizeInGB, minIOPS, maxIOPS)
+	if err != nil {
+		return nil, nil, status.Errorf(cloudErrorCode(err), "Cannot create volume %s: %v", name, err.Error())
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:           volID,
+			CapacityBytes:      capacity,
+			AccessibleTopology: []*csi.Topology{topology},
+		},
+	}, nil, nil
+}
+
+// createVolumeFromSnapshot creates a new volume using a snapshot as
+// content source. offering is the requested disk offering.
+func (cs *controllerServer) createVolumeFromSnapshot(ctx context.Context, req *csi.CreateVolumeRequest, snapshotID string, offering *cloud.DiskOffering) (*csi.CreateVolumeResponse, error) {
+	snapshot, err := cs.connector.GetSnapshotByID(ctx, snapshotID)
+	if errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Snapshot %v not found", snapshotID)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+	if snapshot.State != cloud.SnapshotStateBackedUp {
+		return nil, status.Errorf(codes.Unavailable, "Snapshot %v is not ready: state is %s", snapshotID, snapshot.State)
+	}
+
+	if ok, message := isZoneAccessible(snapshot.ZoneID, req.GetAccessibilityRequirements()); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot restore snapshot %v: %s", snapshotID, message)
+	}
+
+	// The volume gets the disk offering of the snapshot's source volume.
+	// If the source volume was deleted, assume it had the requested one.
+	if sourceVolume, err := cs.connector.GetVolumeByID(ctx, snapshot.VolumeID); err == nil {
+		if offering, err = cs.diskOfferingByID(ctx, offering, sourceVolume.DiskOfferingID); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, cloud.ErrNotFound) {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	return cs.restoreSnapshot(ctx, req, snapshot, offering)
+}
+
+// createVolumeFromVolume clones a volume, using a transient
+// snapshot of the source volume.
+// offering is the requested disk offering.
+func (cs *controllerServer) createVolumeFromVolume(ctx context.Context, req *csi.CreateVolumeRequest, sourceVolume *cloud.Volume, offering *cloud.DiskOffering) (*csi.CreateVolumeResponse, error) {
+	if ok, message := isZoneAccessible(sourceVolume.ZoneID, req.GetAccessibilityRequirements()); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot clone volume %v: %s", sourceVolume.ID, message)
+	}
+
+	// A clone has the disk offering of its source volume
+	offering, err := cs.diskOfferingByID(ctx, offering, sourceVolume.DiskOfferingID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot may remain from a previous failed attempt
+	snapshotName := cloneSnapshotPrefix + req.GetName()
+	snapshot, err := cs.connector.GetSnapshotByName(ctx, snapshotName)
+	if errors.Is(err, cloud.ErrNotFound) {
+		snapshot, err = cs.connector.CreateSnapshot(ctx, sourceVolume.ID, snapshotName)
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, "Cannot parse topology requirements")
+			return nil, status.Errorf(cloudErrorCode(err), "Cannot create snapshot of volume %s: %v", sourceVolume.ID, err.Error())
+		}
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	} else if snapshot.VolumeID != sourceVolume.ID {
+		return nil, status.Errorf(codes.AlreadyExists, "Snapshot %v already exists for another source volume %v", snapshotName, snapshot.VolumeID)
+	}
+	if snapshot.State != cloud.SnapshotStateBackedUp {
+		// Keep the snapshot, to be used by the next attempt
+		return nil, status.Errorf(codes.Unavailable, "Snapshot %v is not ready: state is %s", snapshot.ID, snapshot.State)
+	}
+
+	defer func() {
+		if err := cs.connector.DeleteSnapshot(ctx, snapshot.ID); err != nil && !errors.Is(err, cloud.ErrNotFound) {
+			ctxzap.Extract(ctx).Sugar().Errorw("Cannot delete transient snapshot", "snapshotID", snapshot.ID, "error", err)
+		}
+	}()
+
+	return cs.restoreSnapshot(ctx, req, snapshot, offering)
+}
+
+// restoreSnapshot creates a volume from a snapshot.
+//
+// CloudStack creates the volume in the zone of the snapshot, with the
+// size and disk offering (offering) of the snapshot's source volume.
+func (cs *controllerServer) restoreSnapshot(ctx context.Context, req *csi.CreateVolumeRequest, snapshot *cloud.Snapshot, offering *cloud.DiskOffering) (*csi.CreateVolumeResponse, error) {
+	name := req.GetName()
+
+	if capRange := req.GetCapacityRange(); capRange != nil {
+		if capRange.GetRequiredBytes() > snapshot.Size {
+			return nil, status.Errorf(codes.OutOfRange, "Requested size %v bytes is larger than source size %v bytes", capRange.GetRequiredBytes(), snapshot.Size)
+		}
+		if capRange.GetLimitBytes() > 0 && snapshot.Size > capRange.GetLimitBytes() {
+			return nil, status.Errorf(codes.OutOfRange, "Source size %v bytes exceeds requested limit %v bytes", snapshot.Size, capRange.GetLimitBytes())
 		}
-		zoneID = t.ZoneID
 	}
 
-	volID, err := cs.connector.CreateVolume(ctx, diskOfferingID, zoneID, name, sizeInGB)
+	topology, err := volumeTopology(snapshot.ZoneID, offering, req.GetAccessibilityRequirements())
+	if err != nil {
+		return nil, err
+	}
+
+	volID, err := cs.connector.CreateVolumeFromSnapshot(ctx, snapshot.ID, name)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Cannot create volume %s: %v", name, err.Error())
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot create volume %s from snapshot %s: %v", name, snapshot.ID, err.Error())
 	}
 
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
-			VolumeId:      volID,
-			CapacityBytes: util.GigaBytesToBytes(sizeInGB),
-			AccessibleTopology: []*csi.Topology{
-				Topology{ZoneID: zoneID}.ToCSI(),
-			},
+			VolumeId:           volID,
+			CapacityBytes:      snapshot.Size,
+			ContentSource:      req.GetVolumeContentSource(),
+			AccessibleTopology: []*csi.Topology{topology},
 		},
 	}, nil
 }
 
+// diskOffering resolves the disk offering given in volume parameters by
+// ID, by name or by storage tags. It returns nil if none is given.
+func (cs *controllerServer) diskOffering(ctx context.Context, parameters map[string]string) (*cloud.DiskOffering, error) {
+	id := parameters[DiskOfferingKey]
+	name := parameters[DiskOfferingNameKey]
+	tags := parameters[DiskOfferingTagsKey]
+
+	given := 0
+	for _, p := range []string{id, name, tags} {
+		if p != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "Only one of parameters %v, %v and %v may be set", DiskOfferingKey, DiskOfferingNameKey, DiskOfferingTagsKey)
+	}
+
+	var offering *cloud.DiskOffering
+	var err error
+	var description string
+	switch {
+	case id != "":
+		offering, err = cs.connector.GetDiskOfferingByID(ctx, id)
+		description = id
+	case name != "":
+		offering, err = cs.connector.GetDiskOfferingByName(ctx, name)
+		description = fmt.Sprintf("with name %q", name)
+	case tags != "":
+		list := splitList(tags)
+		if len(list) == 0 {
+			// No tag would match every disk offering
+			return nil, status.Errorf(codes.InvalidArgument, "Parameter %v has no tag", DiskOfferingTagsKey)
+		}
+		offering, err = cs.connector.GetDiskOfferingByTags(ctx, list)
+		description = fmt.Sprintf("with tags %q", tags)
+	default:
+		return nil, nil
+	}
+
+	switch {
+	case errors.Is(err, cloud.ErrNotFound):
+		return nil, status.Errorf(codes.InvalidArgument, "Disk offering %v not found", description)
+	case errors.Is(err, cloud.ErrTooManyResults):
+		return nil, status.Errorf(codes.InvalidArgument, "Disk offering %v is ambiguous: several disk offerings match", description)
+	case err != nil:
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+	return offering, nil
+}
+
+// splitList splits a comma-separated list.
+func splitList(list string) []string {
+	result := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// diskOfferingByID returns the disk offering with the given ID:
+// offering if it has this ID, as already resolved from the volume
+// parameters, or else the one looked up in CloudStack.
+func (cs *controllerServer) diskOfferingByID(ctx context.Context, offering *cloud.DiskOffering, id string) (*cloud.DiskOffering, error) {
+	if offering != nil && offering.ID == id {
+		return offering, nil
+	}
+	offering, err := cs.connector.GetDiskOfferingByID(ctx, id)
+	if errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.InvalidArgument, "Disk offering %v not found", id)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+	return offering, nil
+}
+
+// volumeTopology gives the accessible topology of a volume in a zone.
+//
+// CloudStack allocates volumes of disk offerings using host-local
+// storage on the host of the virtual machine they are first attached
+// to: its API does not allow to choose the host or the storage pool
+// when creating a volume. The host is thus picked from the topology
+// requirement, whose first preferred topology is the one of the node
+// selected by the scheduler with WaitForFirstConsumer binding mode,
+// i.e. the node the volume is expected to be first attached to.
+func volumeTopology(zoneID string, offering *cloud.DiskOffering, topologyRequirement *csi.TopologyRequirement) (*csi.Topology, error) {
+	if !offering.IsLocal() {
+		return Topology{ZoneID: zoneID}.ToCSI(), nil
+	}
+
+	hostID, err := selectHost(zoneID, topologyRequirement)
+	if err != nil {
+		return nil, err
+	}
+	return Topology{ZoneID: zoneID, HostID: hostID}.ToCSI(), nil
+}
+
+// selectHost picks the host of a volume using host-local storage, among
+// the hosts of the zone in the topology requirement. Preferred hosts are
+// tried first, then requisite hosts, in order.
+func selectHost(zoneID string, topologyRequirement *csi.TopologyRequirement) (string, error) {
+	var candidates []*csi.Topology
+	candidates = append(candidates, topologyRequirement.GetPreferred()...)
+	candidates = append(candidates, topologyRequirement.GetRequisite()...)
+	for _, topo := range candidates {
+		t, err := NewTopology(topo)
+		if err != nil {
+			return "", status.Error(codes.InvalidArgument, "Cannot parse topology requirements")
+		}
+		if t.ZoneID == zoneID && t.HostID != "" {
+			return t.HostID, nil
+		}
+	}
+	return "", status.Errorf(codes.InvalidArgument, "Disk offering uses host-local storage, but no host of zone %s is given in topology requirements", zoneID)
+}
+
+// selectZone picks the zone of a new volume among the available zones.
+// Preferred zones are tried first, then requisite zones, in order.
+// Without requisite zones, a random available zone is used as fallback.
+func selectZone(zones []string, topologyRequirement *csi.TopologyRequirement) (string, error) {
+	available := make(map[string]bool, len(zones))
+	for _, z := range zones {
+		available[z] = true
+	}
+
+	var candidates []*csi.Topology
+	candidates = append(candidates, topologyRequirement.GetPreferred()...)
+	candidates = append(candidates, topologyRequirement.GetRequisite()...)
+	for _, topo := range candidates {
+		t, err := NewTopology(topo)
+		if err != nil {
+			return "", status.Error(codes.InvalidArgument, "Cannot parse topology requirements")
+		}
+		if available[t.ZoneID] {
+			return t.ZoneID, nil
+		}
+	}
+
+	if len(topologyRequirement.GetRequisite()) > 0 {
+		return "", status.Error(codes.InvalidArgument, "None of the requisite zones is available for provisioning")
+	}
+	if len(zones) == 0 {
+		return "", status.Error(codes.Internal, "No zone available")
+	}
+	return zones[rand.Intn(len(zones))], nil
+}
+
 func checkVolumeSuitable(vol *cloud.Volume,
-	diskOfferingID string, capRange *csi.CapacityRange, topologyRequirement *csi.TopologyRequirement) (bool, string) {
+	diskOfferingID, snapshotID string, iops volumeIOPS, capRange *csi.CapacityRange, topologyRequirement *csi.TopologyRequirement) (bool, string) {
 
-	if vol.DiskOfferingID != diskOfferingID {
+	if snapshotID != "" {
+		// The disk offering of a volume created from a snapshot
+		// is the one of the snapshot's source volume.
+		if vol.SnapshotID != snapshotID {
+			return false, fmt.Sprintf("Volume source snapshot %s; requested source snapshot %s", vol.SnapshotID, snapshotID)
+		}
+	} else if vol.DiskOfferingID != diskOfferingID {
 		return false, fmt.Sprintf("Disk offering %s; requested disk offering %s", vol.DiskOfferingID, diskOfferingID)
 	}
 
@@ -147,29 +521,62 @@ func checkVolumeSuitable(vol *cloud.Volume,
 		}
 	}
 
-	if topologyRequirement != nil && topologyRequirement.GetRequisite() != nil {
-		reqTopology := topologyRequirement.GetRequisite()
-		if len(reqTopology) > 1 {
-			return false, "Too many topology requirements"
-		}
-		t, err := NewTopology(reqTopology[0])
+	minIOPS, maxIOPS := iops.forSize(util.RoundUpBytesToGB(vol.Size))
+	if minIOPS > 0 && vol.MinIOPS != minIOPS {
+		return false, fmt.Sprintf("Min IOPS %v; requested min IOPS %v", vol.MinIOPS, minIOPS)
+	}
+	if maxIOPS > 0 && vol.MaxIOPS != maxIOPS {
+		return false, fmt.Sprintf("Max IOPS %v; requested max IOPS %v", vol.MaxIOPS, maxIOPS)
+	}
+
+	return isZoneAccessible(vol.ZoneID, topologyRequirement)
+}
+
+// isZoneAccessible checks whether a zone satisfies the topology
+// requirement, i.e. is in one of the requisite segments.
+// If not, it also returns a message explaining why.
+func isZoneAccessible(zoneID string, topologyRequirement *csi.TopologyRequirement) (bool, string) {
+	reqTopology := topologyRequirement.GetRequisite()
+	if len(reqTopology) == 0 {
+		return true, ""
+	}
+
+	requestedZones := make([]string, 0, len(reqTopology))
+	for _, topo := range reqTopology {
+		t, err := NewTopology(topo)
 		if err != nil {
 			return false, "Cannot parse topology requirements"
 		}
-		if t.ZoneID != vol.ZoneID {
-			return false, fmt.Sprintf("Volume in zone %s, requested zone is %s", vol.ZoneID, t.ZoneID)
+		if t.ZoneID == zoneID {
+			return true, ""
 		}
+		requestedZones = append(requestedZones, t.ZoneID)
 	}
-
-	return true, ""
+	return false, fmt.Sprintf("Volume in zone %s, requested zones are %v", zoneID, requestedZones)
 }
 
 func determineSize(req *csi.CreateVolumeRequest) (int64, error) {
-	var sizeInGB int64
+	return sizeFromCapacityRange(req.GetCapacityRange())
+}
 
-	if req.GetCapacityRange() != nil {
-		capRange := req.GetCapacityRange()
+// checkFixedSize checks that the fixed size (in Bytes)
+// of a disk offering satisfies the capacity range.
+func checkFixedSize(size int64, capRange *csi.CapacityRange) error {
+	if required := capRange.GetRequiredBytes(); size < required {
+		return fmt.Errorf("fixed size %v bytes is smaller than the required %v bytes", size, required)
+	}
+	if limit := capRange.GetLimitBytes(); limit > 0 && size > limit {
+		return fmt.Errorf("fixed size %v bytes exceeds the limit of %v bytes", size, limit)
+	}
+	return nil
+}
+
+// sizeFromCapacityRange gives the smallest size in GB
+// satisfying the capacity range.
+func sizeFromCapacityRange(capRange *csi.CapacityRange) (int64, error) {
+	var sizeInGB int64
 
+	if capRange != nil {
 		required := capRange.GetRequiredBytes()
 		sizeInGB = util.RoundUpBytesToGB(required)
 		if sizeInGB == 0 {
@@ -195,13 +602,301 @@ func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	}
 
 	volumeID := req.GetVolumeId()
+
+	if !cs.volumeLocks.TryLock(volumeID) {
+		return nil, status.Errorf(codes.Aborted, "An operation on volume %s is already in progress", volumeID)
+	}
+	defer cs.volumeLocks.Unlock(volumeID)
+
 	err := cs.connector.DeleteVolume(ctx, volumeID)
-	if err != nil && err != cloud.ErrNotFound {
-		return nil, status.Errorf(codes.Internal, "Cannot delete volume %s: %s", volumeID, err.Error())
+	if errors.Is(err, cloud.ErrInvalidParameter) {
+		// The volume exists but is still in use, e.g. attached to a VM
+		return nil, status.Errorf(codes.FailedPrecondition, "Cannot delete volume %s: %s", volumeID, err.Error())
+	}
+	if err != nil && !errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot delete volume %s: %s", volumeID, err.Error())
 	}
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
+func (cs *controllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	maxEntries := int(req.GetMaxEntries())
+	if maxEntries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid max entries %v", maxEntries)
+	}
+
+	// The token is the index of the first entry
+	start := 0
+	if token := req.GetStartingToken(); token != "" {
+		var err error
+		start, err = strconv.Atoi(token)
+		if err != nil || start < 0 {
+			return nil, status.Errorf(codes.Aborted, "Invalid starting token %v", token)
+		}
+	}
+
+	var (
+		volumes []cloud.Volume
+		total   int
+	)
+	if cs.clusterID != "" && maxEntries > 0 && start%maxEntries == 0 {
+		// CloudStack filters the volumes of the cluster by
+		// tag, so its pages are those of the response.
+		var err error
+		volumes, total, err = cs.connector.ListVolumes(ctx, cs.clusterTags(), start/maxEntries+1, maxEntries)
+		if err != nil {
+			return nil, status.Errorf(cloudErrorCode(err), "Cannot list volumes: %v", err)
+		}
+	} else {
+		all, err := cs.listDriverVolumes(ctx)
+		if err != nil {
+			return nil, status.Errorf(cloudErrorCode(err), "Cannot list volumes: %v", err)
+		}
+		total = len(all)
+		if start <= total {
+			end := total
+			if maxEntries > 0 && start+maxEntries < end {
+				end = start + maxEntries
+			}
+			volumes = all[start:end]
+		}
+	}
+	if start > total {
+		return nil, status.Errorf(codes.Aborted, "Invalid starting token %v", req.GetStartingToken())
+	}
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(volumes))
+	for _, vol := range volumes {
+		var publishedNodeIDs []string
+		if vol.VirtualMachineID != "" {
+			publishedNodeIDs = []string{vol.VirtualMachineID}
+		}
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      vol.ID,
+				CapacityBytes: vol.Size,
+				AccessibleTopology: []*csi.Topology{
+					Topology{ZoneID: vol.ZoneID}.ToCSI(),
+				},
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodeIDs,
+				VolumeCondition:  volumeCondition(&vol),
+			},
+		})
+	}
+	var nextToken string
+	if end := start + len(volumes); end < total {
+		nextToken = strconv.Itoa(end)
+	}
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// listDriverVolumes lists all the volumes of the driver, page by page.
+// Volumes are filtered by CloudStack if a cluster ID is set, or else
+// after being listed.
+func (cs *controllerServer) listDriverVolumes(ctx context.Context) ([]cloud.Volume, error) {
+	var all []cloud.Volume
+	for page := 1; ; page++ {
+		vols, total, err := cs.connector.ListVolumes(ctx, cs.clusterTags(), page, listVolumesPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, vol := range vols {
+			if cs.isDriverVolume(&vol) {
+				all = append(all, vol)
+			}
+		}
+		if len(vols) < listVolumesPageSize || page*listVolumesPageSize >= total {
+			return all, nil
+		}
+	}
+}
+
+// clusterTags gives the tags of the volumes of the
+// cluster, or nil if no cluster ID is set.
+func (cs *controllerServer) clusterTags() map[string]string {
+	if cs.clusterID == "" {
+		return nil
+	}
+	return map[string]string{ClusterIDTagKey: cs.clusterID}
+}
+
+// isDriverVolume checks whether a volume was created by the driver: by
+// its cluster ID tag if a cluster ID is set, or else by its name prefix.
+func (cs *controllerServer) isDriverVolume(vol *cloud.Volume) bool {
+	if cs.clusterID != "" {
+		return vol.Tags[ClusterIDTagKey] == cs.clusterID
+	}
+	return strings.HasPrefix(vol.Name, cs.volumeNamePrefix)
+}
+
+func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+
+	vol, err := cs.connector.GetVolumeByID(ctx, volumeID)
+	if errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	var publishedNodeIDs []string
+	if vol.VirtualMachineID != "" {
+		publishedNodeIDs = []string{vol.VirtualMachineID}
+	}
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      vol.ID,
+			CapacityBytes: vol.Size,
+			AccessibleTopology: []*csi.Topology{
+				Topology{ZoneID: vol.ZoneID}.ToCSI(),
+			},
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: publishedNodeIDs,
+			VolumeCondition:  volumeCondition(vol),
+		},
+	}, nil
+}
+
+// volumeCondition maps the CloudStack state of a volume
+// to a CSI volume condition.
+func volumeCondition(vol *cloud.Volume) *csi.VolumeCondition {
+	switch vol.State {
+	case cloud.VolumeStateReady:
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "Volume is ready",
+		}
+	case cloud.VolumeStateAllocated:
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "Volume is allocated, it will be created on primary storage when first attached",
+		}
+	case cloud.VolumeStateCreating, cloud.VolumeStateResizing, cloud.VolumeStateMigrating,
+		cloud.VolumeStateCopying, cloud.VolumeStateSnapshotting, cloud.VolumeStateRevertSnapshotting,
+		cloud.VolumeStateAttaching:
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  fmt.Sprintf("Volume is in transient state %s", vol.State),
+		}
+	case cloud.VolumeStateDestroy:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  "Volume has been destroyed in CloudStack and is waiting to be expunged",
+		}
+	case cloud.VolumeStateExpunging, cloud.VolumeStateExpunged:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  "Volume has been expunged in CloudStack",
+		}
+	default:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume is in unexpected state %q", vol.State),
+		}
+	}
+}
+
+func (cs *controllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	var zoneID, hostID string
+	if req.GetAccessibleTopology() != nil {
+		t, err := NewTopology(req.GetAccessibleTopology())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Cannot parse accessible topology")
+		}
+		zoneID, hostID = t.ZoneID, t.HostID
+	}
+
+	offering, err := cs.diskOffering(ctx, req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+
+	capacity, err := cs.connector.GetStoragePoolsCapacity(ctx, zoneID, hostID, offering)
+	if errors.Is(err, cloud.ErrUnauthorized) {
+		// Listing storage pools requires an admin account:
+		// only the account resource limits are known.
+		ctxzap.Extract(ctx).Sugar().Debugw("Cannot list storage pools; using account resource limits only", "error", err)
+		capacity = math.MaxInt64
+	} else if err != nil {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot get storage pools capacity: %v", err)
+	}
+
+	// The account resource limits may be more restrictive
+	available, err := cs.connector.GetAvailablePrimaryStorage(ctx)
+	if err != nil {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot get account resource limits: %v", err)
+	}
+	if available != cloud.UnlimitedCapacity && available < capacity {
+		capacity = available
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: capacity,
+	}, nil
+}
+
+func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	// Check arguments
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	volumeID := req.GetVolumeId()
+
+	capRange := req.GetCapacityRange()
+	if capRange == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity range missing in request")
+	}
+	sizeInGB, err := sizeFromCapacityRange(capRange)
+	if err != nil {
+		return nil, status.Error(codes.OutOfRange, err.Error())
+	}
+
+	if !cs.volumeLocks.TryLock(volumeID) {
+		return nil, status.Errorf(codes.Aborted, "An operation on volume %s is already in progress", volumeID)
+	}
+	defer cs.volumeLocks.Unlock(volumeID)
+
+	// Check volume
+	vol, err := cs.connector.GetVolumeByID(ctx, volumeID)
+	if errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	// Node expansion is also required for block volumes:
+	// the node rescans the device to see its new size.
+	if vol.Size >= util.GigaBytesToBytes(sizeInGB) {
+		// Volume already has the requested size
+		return &csi.ControllerExpandVolumeResponse{
+			CapacityBytes:         vol.Size,
+			NodeExpansionRequired: true,
+		}, nil
+	}
+
+	err = cs.connector.ResizeVolume(ctx, volumeID, sizeInGB)
+	if err != nil {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot resize volume %s: %s", volumeID, err.Error())
+	}
+
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         util.GigaBytesToBytes(sizeInGB),
+		NodeExpansionRequired: true,
+	}, nil
+}
+
 func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
 	// Check arguments
 
@@ -226,24 +921,29 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Error(codes.InvalidArgument, "Access mode not accepted")
 	}
 
+	if !cs.volumeLocks.TryLock(volumeID) {
+		return nil, status.Errorf(codes.Aborted, "An operation on volume %s is already in progress", volumeID)
+	}
+	defer cs.volumeLocks.Unlock(volumeID)
+
 	// Check volume
 	vol, err := cs.connector.GetVolumeByID(ctx, volumeID)
-	if err == cloud.ErrNotFound {
+	if errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	}
 
 	if vol.VirtualMachineID != "" && vol.VirtualMachineID != nodeID {
 		return nil, status.Error(codes.AlreadyExists, "Volume already assigned")
 	}
 
-	if _, err := cs.connector.GetVMByID(ctx, nodeID); err == cloud.ErrNotFound {
+	if _, err := cs.connector.GetVMByID(ctx, nodeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "VM %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	}
 
 	if vol.VirtualMachineID == nodeID {
@@ -255,9 +955,14 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext}, nil
 	}
 
+	if err := cs.lockVM(ctx, nodeID); err != nil {
+		return nil, err
+	}
+	defer cs.vmLocks.Unlock(nodeID)
+
 	deviceID, err := cs.connector.AttachVolume(ctx, volumeID, nodeID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Cannot attach volume %s: %s", volumeID, err.Error())
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot attach volume %s: %s", volumeID, err.Error())
 	}
 
 	publishContext := map[string]string{
@@ -279,40 +984,64 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 	}
 	nodeID := req.GetNodeId()
 
+	if !cs.volumeLocks.TryLock(volumeID) {
+		return nil, status.Errorf(codes.Aborted, "An operation on volume %s is already in progress", volumeID)
+	}
+	defer cs.volumeLocks.Unlock(volumeID)
+
 	// Check volume
-	if vol, err := cs.connector.GetVolumeByID(ctx, volumeID); err == cloud.ErrNotFound {
+	if vol, err := cs.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	} else if vol.VirtualMachineID != nodeID {
 		// Nothing to do
 		return &csi.ControllerUnpublishVolumeResponse{}, nil
 	}
 
 	// Check VM existence
-	if _, err := cs.connector.GetVolumeByID(ctx, volumeID); err == cloud.ErrNotFound {
+	if _, err := cs.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	}
 
-	if _, err := cs.connector.GetVMByID(ctx, nodeID); err == cloud.ErrNotFound {
+	if _, err := cs.connector.GetVMByID(ctx, nodeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "VM %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	if err := cs.lockVM(ctx, nodeID); err != nil {
+		return nil, err
 	}
+	defer cs.vmLocks.Unlock(nodeID)
 
 	err := cs.connector.DetachVolume(ctx, volumeID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Cannot detach volume %s: %s", volumeID, err.Error())
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot detach volume %s: %s", volumeID, err.Error())
 	}
 
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
+// lockVM waits for the attach and detach operations in progress on a VM,
+// since CloudStack does not handle concurrent ones. The lock must be
+// released using cs.vmLocks.Unlock.
+func (cs *controllerServer) lockVM(ctx context.Context, vmID string) error {
+	if err := cs.vmLocks.Lock(ctx, vmID); err != nil {
+		code := codes.Canceled
+		if err == context.DeadlineExceeded {
+			code = codes.DeadlineExceeded
+		}
+		return status.Errorf(code, "Cannot wait for operations in progress on VM %s: %v", vmID, err)
+	}
+	return nil
+}
+
 func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -324,11 +1053,11 @@ func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "Volume capabilities not provided")
 	}
 
-	if _, err := cs.connector.GetVolumeByID(ctx, volumeID); err == cloud.ErrNotFound {
+	if _, err := cs.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	}
 
 	var confirmed *csi.ValidateVolumeCapabilitiesResponse_Confirmed
@@ -349,6 +1078,131 @@ func isValidVolumeCapabilities(volCaps []*csi.VolumeCapability) bool {
 	return true
 }
 
+func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	// Check arguments
+
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot name missing in request")
+	}
+	name := req.GetName()
+
+	if req.GetSourceVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Source volume ID missing in request")
+	}
+	volumeID := req.GetSourceVolumeId()
+
+	// Check if a snapshot with that name already exists
+	if snap, err := cs.connector.GetSnapshotByName(ctx, name); errors.Is(err, cloud.ErrNotFound) {
+		// The snapshot does not exist
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "CloudStack error: %v", err)
+	} else {
+		// The snapshot exists. Check if it suits the request.
+		if snap.VolumeID != volumeID {
+			return nil, status.Errorf(codes.AlreadyExists, "Snapshot %v already exists for another source volume %v", name, snap.VolumeID)
+		}
+		// Existing snapshot is ok
+		return &csi.CreateSnapshotResponse{
+			Snapshot: toCSISnapshot(snap),
+		}, nil
+	}
+
+	// Check source volume
+	if _, err := cs.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	snap, err := cs.connector.CreateSnapshot(ctx, volumeID, name)
+	if err != nil {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot create snapshot %s: %v", name, err.Error())
+	}
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: toCSISnapshot(snap),
+	}, nil
+}
+
+func (cs *controllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	if req.GetSnapshotId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in request")
+	}
+
+	snapshotID := req.GetSnapshotId()
+	err := cs.connector.DeleteSnapshot(ctx, snapshotID)
+	if err != nil && !errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(cloudErrorCode(err), "Cannot delete snapshot %s: %s", snapshotID, err.Error())
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (cs *controllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	var snapshots []cloud.Snapshot
+
+	if snapshotID := req.GetSnapshotId(); snapshotID != "" {
+		snap, err := cs.connector.GetSnapshotByID(ctx, snapshotID)
+		if errors.Is(err, cloud.ErrNotFound) {
+			return &csi.ListSnapshotsResponse{}, nil
+		} else if err != nil {
+			// Error with CloudStack
+			return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+		}
+		if req.GetSourceVolumeId() != "" && snap.VolumeID != req.GetSourceVolumeId() {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		snapshots = []cloud.Snapshot{*snap}
+	} else {
+		var err error
+		snapshots, err = cs.connector.ListSnapshots(ctx, req.GetSourceVolumeId())
+		if err != nil {
+			return nil, status.Errorf(cloudErrorCode(err), "Cannot list snapshots: %v", err)
+		}
+	}
+
+	// Paginate using the index of the first entry as token
+	start := 0
+	if token := req.GetStartingToken(); token != "" {
+		var err error
+		start, err = strconv.Atoi(token)
+		if err != nil || start < 0 || start > len(snapshots) {
+			return nil, status.Errorf(codes.Aborted, "Invalid starting token %v", token)
+		}
+	}
+	end := len(snapshots)
+	if max := int(req.GetMaxEntries()); max > 0 && start+max < end {
+		end = start + max
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, end-start)
+	for i := start; i < end; i++ {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: toCSISnapshot(&snapshots[i]),
+		})
+	}
+	var nextToken string
+	if end < len(snapshots) {
+		nextToken = strconv.Itoa(end)
+	}
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// toCSISnapshot converts a CloudStack snapshot to a *csi.Snapshot.
+func toCSISnapshot(snap *cloud.Snapshot) *csi.Snapshot {
+	return &csi.Snapshot{
+		SnapshotId:     snap.ID,
+		SourceVolumeId: snap.VolumeID,
+		SizeBytes:      snap.Size,
+		CreationTime:   timestamppb.New(snap.CreatedAt),
+		ReadyToUse:     snap.State == cloud.SnapshotStateBackedUp,
+	}
+}
+
 func (cs *controllerServer) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
 	return &csi.ControllerGetCapabilitiesResponse{
 		Capabilities: []*csi.ControllerServiceCapability{
@@ -366,6 +1220,69 @@ func (cs *controllerServer) ControllerGetCapabilities(ctx context.Context, req *
 					},
 				},
 			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_GET_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -1,9 +1,20 @@
 package driver
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud/fake"
 )
 
 func TestDetermineSize(t *testing.T) {
@@ -40,3 +51,1140 @@ func TestDetermineSize(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckVolumeSuitable(t *testing.T) {
+	vol := &cloud.Volume{
+		ID:             "vol-id",
+		Size:           10 * 1024 * 1024 * 1024,
+		DiskOfferingID: "offering-1",
+		ZoneID:         "zone-1",
+		SnapshotID:     "snap-1",
+	}
+	cases := []struct {
+		name           string
+		diskOfferingID string
+		snapshotID     string
+		capacityRange  *csi.CapacityRange
+		topology       *csi.TopologyRequirement
+		expectSuitable bool
+	}{
+		{"same offering", "offering-1", "", nil, nil, true},
+		{"other offering", "offering-2", "", nil, nil, false},
+		{"same snapshot", "offering-2", "snap-1", nil, nil, true},
+		{"other snapshot", "offering-1", "snap-2", nil, nil, false},
+		{"size in range", "offering-1", "", &csi.CapacityRange{RequiredBytes: 5 * 1024 * 1024 * 1024}, nil, true},
+		{"size too small", "offering-1", "", &csi.CapacityRange{RequiredBytes: 20 * 1024 * 1024 * 1024}, nil, false},
+		{"size too large", "offering-1", "", &csi.CapacityRange{LimitBytes: 5 * 1024 * 1024 * 1024}, nil, false},
+		{"same zone", "offering-1", "", nil, &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{{Segments: map[string]string{ZoneKey: "zone-1"}}},
+		}, true},
+		{"other zone", "offering-1", "", nil, &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{{Segments: map[string]string{ZoneKey: "zone-2"}}},
+		}, false},
+		{"one of requisite zones", "offering-1", "", nil, &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{Segments: map[string]string{ZoneKey: "zone-2"}},
+				{Segments: map[string]string{ZoneKey: "zone-1"}},
+			},
+		}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ok, message := checkVolumeSuitable(vol, c.diskOfferingID, c.snapshotID, volumeIOPS{}, c.capacityRange, c.topology)
+			if ok != c.expectSuitable {
+				t.Errorf("Expected suitable=%v, got %v (%s)", c.expectSuitable, ok, message)
+			}
+		})
+	}
+}
+
+// pagesConnector is a fake connector which
+// records the pages of volumes listed.
+type pagesConnector struct {
+	cloud.Interface
+	pages []string
+}
+
+func (c *pagesConnector) ListVolumes(ctx context.Context, tags map[string]string, page, pageSize int) ([]cloud.Volume, int, error) {
+	c.pages = append(c.pages, fmt.Sprintf("%d/%d", page, pageSize))
+	return c.Interface.ListVolumes(ctx, tags, page, pageSize)
+}
+
+func TestListVolumesPagination(t *testing.T) {
+	ctx := context.Background()
+	for _, clusterID := range []string{"", "cluster-1"} {
+		t.Run("cluster ID "+clusterID, func(t *testing.T) {
+			connector := fake.New()
+			for i := 0; i < 5; i++ {
+				volumeID, err := connector.CreateVolume(ctx, "offering", "zone", "pvc-"+strconv.Itoa(i), 1, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				vol, err := connector.GetVolumeByID(ctx, volumeID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := connector.TagVolume(ctx, vol, map[string]string{ClusterIDTagKey: "cluster-1"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			testListVolumesPagination(t, NewControllerServer(connector, clusterID, DefaultVolumeNamePrefix))
+		})
+	}
+}
+
+func testListVolumesPagination(t *testing.T, cs csi.ControllerServer) {
+	ctx := context.Background()
+	cases := []struct {
+		name              string
+		startingToken     string
+		maxEntries        int32
+		expectedCode      codes.Code
+		expectedEntries   int
+		expectedNextToken string
+	}{
+		{"all", "", 0, codes.OK, 5, ""},
+		{"first page", "", 2, codes.OK, 2, "2"},
+		{"all remaining", "2", 0, codes.OK, 3, ""},
+		{"across pages", "3", 2, codes.OK, 2, ""},
+		{"middle", "1", 3, codes.OK, 3, "4"},
+		{"at the end", "5", 2, codes.OK, 0, ""},
+		{"beyond the end", "10", 2, codes.Aborted, 0, ""},
+		{"invalid token", "abc", 2, codes.Aborted, 0, ""},
+		{"negative token", "-1", 2, codes.Aborted, 0, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{
+				StartingToken: c.startingToken,
+				MaxEntries:    c.maxEntries,
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if len(resp.GetEntries()) != c.expectedEntries {
+				t.Errorf("Expected %v entries, got %v", c.expectedEntries, len(resp.GetEntries()))
+			}
+			if resp.GetNextToken() != c.expectedNextToken {
+				t.Errorf("Expected next token %q, got %q", c.expectedNextToken, resp.GetNextToken())
+			}
+		})
+	}
+}
+
+func TestListVolumesPages(t *testing.T) {
+	cases := []struct {
+		name          string
+		clusterID     string
+		startingToken string
+		maxEntries    int32
+		expected      string
+	}{
+		{"cluster ID", "cluster-1", "4", 2, "3/2"},
+		{"cluster ID, all entries", "cluster-1", "", 0, fmt.Sprintf("1/%d", listVolumesPageSize)},
+		{"cluster ID, token not on a page", "cluster-1", "3", 2, fmt.Sprintf("1/%d", listVolumesPageSize)},
+		{"name prefix", "", "4", 2, fmt.Sprintf("1/%d", listVolumesPageSize)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &pagesConnector{Interface: fake.New()}
+			cs := NewControllerServer(connector, c.clusterID, DefaultVolumeNamePrefix)
+			_, err := cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{
+				StartingToken: c.startingToken,
+				MaxEntries:    c.maxEntries,
+			})
+			if err != nil && status.Code(err) != codes.Aborted {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(connector.pages) != 1 || connector.pages[0] != c.expected {
+				t.Errorf("Expected page %v, got %v", c.expected, connector.pages)
+			}
+		})
+	}
+}
+
+func TestListVolumesOfDriver(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	for _, name := range []string{"pvc-1", "pvc-2", "data"} {
+		if _, err := connector.CreateVolume(ctx, "offering", "zone", name, 1, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged, err := connector.GetVolumeByName(ctx, "pvc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.TagVolume(ctx, tagged, map[string]string{ClusterIDTagKey: "cluster-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name             string
+		clusterID        string
+		volumeNamePrefix string
+		expected         int
+	}{
+		{"by name prefix", "", DefaultVolumeNamePrefix, 2},
+		{"by cluster ID", "cluster-1", DefaultVolumeNamePrefix, 1},
+		{"all", "", "", 4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cs := NewControllerServer(connector, c.clusterID, c.volumeNamePrefix)
+			resp, err := cs.ListVolumes(ctx, &csi.ListVolumesRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(resp.GetEntries()) != c.expected {
+				t.Errorf("Expected %v entries, got %v", c.expected, len(resp.GetEntries()))
+			}
+		})
+	}
+}
+
+func TestVolumeCondition(t *testing.T) {
+	cases := []struct {
+		state          string
+		expectAbnormal bool
+	}{
+		{cloud.VolumeStateReady, false},
+		{cloud.VolumeStateAllocated, false},
+		{cloud.VolumeStateMigrating, false},
+		{cloud.VolumeStateResizing, false},
+		{cloud.VolumeStateDestroy, true},
+		{cloud.VolumeStateExpunged, true},
+		{"UploadError", true},
+		{"", true},
+	}
+	for _, c := range cases {
+		t.Run(c.state, func(t *testing.T) {
+			cond := volumeCondition(&cloud.Volume{State: c.state})
+			if cond.GetAbnormal() != c.expectAbnormal {
+				t.Errorf("Expected abnormal=%v, got %v (%s)", c.expectAbnormal, cond.GetAbnormal(), cond.GetMessage())
+			}
+			if cond.GetMessage() == "" {
+				t.Error("Expected a message")
+			}
+		})
+	}
+}
+
+func TestCreateVolumeRequisiteZone(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+	zones, err := connector.ListZonesID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name         string
+		zoneID       string
+		expectedCode codes.Code
+	}{
+		{"allowed zone", zones[0], codes.OK},
+		{"other zone", "other-zone", codes.InvalidArgument},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := cs.CreateVolume(ctx, &csi.CreateVolumeRequest{
+				Name: "vol-" + c.zoneID,
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &onlyVolumeCapAccessMode,
+				}},
+				Parameters: map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c"},
+				AccessibilityRequirements: &csi.TopologyRequirement{
+					Requisite: []*csi.Topology{Topology{ZoneID: c.zoneID}.ToCSI()},
+				},
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Errorf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+		})
+	}
+}
+
+func TestSelectZone(t *testing.T) {
+	topo := func(zoneIDs ...string) []*csi.Topology {
+		result := make([]*csi.Topology, 0, len(zoneIDs))
+		for _, zoneID := range zoneIDs {
+			result = append(result, Topology{ZoneID: zoneID}.ToCSI())
+		}
+		return result
+	}
+	zones := []string{"zone-1", "zone-2", "zone-3"}
+
+	cases := []struct {
+		name         string
+		requirement  *csi.TopologyRequirement
+		expectedZone string
+		expectedCode codes.Code
+	}{
+		{"requisite", &csi.TopologyRequirement{Requisite: topo("zone-2")}, "zone-2", codes.OK},
+		{"first available requisite", &csi.TopologyRequirement{Requisite: topo("zone-4", "zone-3", "zone-1")}, "zone-3", codes.OK},
+		{"preferred first", &csi.TopologyRequirement{
+			Requisite: topo("zone-1", "zone-2", "zone-3"),
+			Preferred: topo("zone-3", "zone-2"),
+		}, "zone-3", codes.OK},
+		{"unavailable preferred", &csi.TopologyRequirement{
+			Requisite: topo("zone-4", "zone-2"),
+			Preferred: topo("zone-4"),
+		}, "zone-2", codes.OK},
+		{"preferred only", &csi.TopologyRequirement{Preferred: topo("zone-2")}, "zone-2", codes.OK},
+		{"no available requisite", &csi.TopologyRequirement{Requisite: topo("zone-4", "zone-5")}, "", codes.InvalidArgument},
+		{"invalid topology", &csi.TopologyRequirement{Requisite: []*csi.Topology{{}}}, "", codes.InvalidArgument},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			zoneID, err := selectZone(zones, c.requirement)
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if zoneID != c.expectedZone {
+				t.Errorf("Expected zone %q, got %q", c.expectedZone, zoneID)
+			}
+		})
+	}
+
+	t.Run("random zone", func(t *testing.T) {
+		zoneID, err := selectZone(zones, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zoneID == "" {
+			t.Error("Expected a zone")
+		}
+	})
+	t.Run("no zone", func(t *testing.T) {
+		if _, err := selectZone(nil, nil); status.Code(err) != codes.Internal {
+			t.Errorf("Expected code %v, got %v", codes.Internal, status.Code(err))
+		}
+	})
+}
+
+func TestSelectHost(t *testing.T) {
+	cases := []struct {
+		name         string
+		requirement  *csi.TopologyRequirement
+		expectedHost string
+		expectedCode codes.Code
+	}{
+		{"preferred host", &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				Topology{ZoneID: "zone-1", HostID: "host-1"}.ToCSI(),
+				Topology{ZoneID: "zone-1", HostID: "host-2"}.ToCSI(),
+			},
+			Preferred: []*csi.Topology{
+				Topology{ZoneID: "zone-1", HostID: "host-2"}.ToCSI(),
+			},
+		}, "host-2", codes.OK},
+		{"host in zone", &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				Topology{ZoneID: "zone-2", HostID: "host-3"}.ToCSI(),
+				Topology{ZoneID: "zone-1"}.ToCSI(),
+				Topology{ZoneID: "zone-1", HostID: "host-1"}.ToCSI(),
+			},
+		}, "host-1", codes.OK},
+		{"no host", &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{Topology{ZoneID: "zone-1"}.ToCSI()},
+		}, "", codes.InvalidArgument},
+		{"no requirement", nil, "", codes.InvalidArgument},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hostID, err := selectHost("zone-1", c.requirement)
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if hostID != c.expectedHost {
+				t.Errorf("Expected host %q, got %q", c.expectedHost, hostID)
+			}
+		})
+	}
+}
+
+func TestVolumeTopology(t *testing.T) {
+	requirement := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{Topology{ZoneID: "zone-1", HostID: "host-1"}.ToCSI()},
+	}
+	shared := &cloud.DiskOffering{ID: "shared", StorageType: "shared"}
+	local := &cloud.DiskOffering{ID: "local", StorageType: "local"}
+
+	topology, err := volumeTopology("zone-1", shared, requirement)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := (Topology{ZoneID: "zone-1"}.ToCSI()); !reflect.DeepEqual(topology.GetSegments(), expected.GetSegments()) {
+		t.Errorf("Expected %v, got %v", expected.GetSegments(), topology.GetSegments())
+	}
+
+	topology, err = volumeTopology("zone-1", local, requirement)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := (Topology{ZoneID: "zone-1", HostID: "host-1"}.ToCSI()); !reflect.DeepEqual(topology.GetSegments(), expected.GetSegments()) {
+		t.Errorf("Expected %v, got %v", expected.GetSegments(), topology.GetSegments())
+	}
+}
+
+// offeringLookupsConnector is a fake connector
+// which counts the lookups of disk offerings by ID.
+type offeringLookupsConnector struct {
+	cloud.Interface
+	lookups int
+}
+
+func (c *offeringLookupsConnector) GetDiskOfferingByID(ctx context.Context, id string) (*cloud.DiskOffering, error) {
+	c.lookups++
+	return c.Interface.GetDiskOfferingByID(ctx, id)
+}
+
+func TestCreateVolumeResolvesOfferingOnce(t *testing.T) {
+	connector := &offeringLookupsConnector{Interface: fake.New()}
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+	req := &csi.CreateVolumeRequest{
+		Name: "offering-once",
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &onlyVolumeCapAccessMode,
+		}},
+		Parameters: map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c"},
+	}
+	for i := 0; i < 2; i++ {
+		connector.lookups = 0
+		if _, err := cs.CreateVolume(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if connector.lookups != 1 {
+			t.Errorf("Expected 1 lookup of the disk offering, got %d", connector.lookups)
+		}
+	}
+}
+
+func TestControllerPublishVolumeInProgress(t *testing.T) {
+	ctx := context.Background()
+	cs := NewControllerServer(fake.New(), "", DefaultVolumeNamePrefix).(*controllerServer)
+	volumeID := "ace9f28b-3081-40c1-8353-4cc3e3014072"
+
+	if !cs.volumeLocks.TryLock(volumeID) {
+		t.Fatal("Expected volume lock to be acquired")
+	}
+	_, err := cs.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId: volumeID,
+		NodeId:   "0d7107a3-94d2-44e7-89b8-8930881309a5",
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &onlyVolumeCapAccessMode,
+		},
+	})
+	if code := status.Code(err); code != codes.Aborted {
+		t.Errorf("Expected code %v, got %v (%v)", codes.Aborted, code, err)
+	}
+
+	cs.volumeLocks.Unlock(volumeID)
+	if _, err := cs.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volumeID,
+		NodeId:   "0d7107a3-94d2-44e7-89b8-8930881309a5",
+	}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// ambiguousOfferingConnector is a fake connector
+// where several disk offerings match any name.
+type ambiguousOfferingConnector struct {
+	cloud.Interface
+}
+
+func (c *ambiguousOfferingConnector) GetDiskOfferingByName(ctx context.Context, name string) (*cloud.DiskOffering, error) {
+	return nil, cloud.ErrTooManyResults
+}
+
+func TestDiskOffering(t *testing.T) {
+	ctx := context.Background()
+	const offeringID = "9743fd77-0f5d-4ef9-b2f8-f194235c769c"
+
+	cases := []struct {
+		name         string
+		connector    cloud.Interface
+		parameters   map[string]string
+		expectedID   string
+		expectedCode codes.Code
+	}{
+		{"by ID", fake.New(), map[string]string{DiskOfferingKey: offeringID}, offeringID, codes.OK},
+		{"by name", fake.New(), map[string]string{DiskOfferingNameKey: "Custom"}, offeringID, codes.OK},
+		{"by tags", fake.New(), map[string]string{DiskOfferingTagsKey: " standard , "}, offeringID, codes.OK},
+		{"no tags", fake.New(), map[string]string{DiskOfferingTagsKey: " , "}, "", codes.InvalidArgument},
+		{"none", fake.New(), map[string]string{}, "", codes.OK},
+		{"unknown ID", fake.New(), map[string]string{DiskOfferingKey: "unknown"}, "", codes.InvalidArgument},
+		{"unknown name", fake.New(), map[string]string{DiskOfferingNameKey: "unknown"}, "", codes.InvalidArgument},
+		{"unknown tags", fake.New(), map[string]string{DiskOfferingTagsKey: "ssd"}, "", codes.InvalidArgument},
+		{"ambiguous name", &ambiguousOfferingConnector{fake.New()}, map[string]string{DiskOfferingNameKey: "Custom"}, "", codes.InvalidArgument},
+		{"ID and name", fake.New(), map[string]string{DiskOfferingKey: offeringID, DiskOfferingNameKey: "Custom"}, "", codes.InvalidArgument},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cs := NewControllerServer(c.connector, "", DefaultVolumeNamePrefix).(*controllerServer)
+			offering, err := cs.diskOffering(ctx, c.parameters)
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			var id string
+			if offering != nil {
+				id = offering.ID
+			}
+			if id != c.expectedID {
+				t.Errorf("Expected disk offering %q, got %q", c.expectedID, id)
+			}
+		})
+	}
+}
+
+// fixedOfferingConnector is a fake connector with a fixed-size
+// disk offering, which records the size of created volumes.
+type fixedOfferingConnector struct {
+	cloud.Interface
+	sizeInGB int64
+}
+
+func (c *fixedOfferingConnector) GetDiskOfferingByID(ctx context.Context, id string) (*cloud.DiskOffering, error) {
+	if id != "fixed" {
+		return c.Interface.GetDiskOfferingByID(ctx, id)
+	}
+	return &cloud.DiskOffering{
+		ID:          "fixed",
+		Name:        "Fixed 10GB",
+		StorageType: "shared",
+		Size:        10 * 1024 * 1024 * 1024,
+	}, nil
+}
+
+func (c *fixedOfferingConnector) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB, minIOPS, maxIOPS int64) (string, error) {
+	c.sizeInGB = sizeInGB
+	return c.Interface.CreateVolume(ctx, diskOfferingID, zoneID, name, sizeInGB, minIOPS, maxIOPS)
+}
+
+func TestCreateVolumeFixedSize(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	cases := []struct {
+		name         string
+		capRange     *csi.CapacityRange
+		expectedCode codes.Code
+	}{
+		{"no range", nil, codes.OK},
+		{"fitting range", &csi.CapacityRange{RequiredBytes: 5 * gb, LimitBytes: 10 * gb}, codes.OK},
+		{"required too large", &csi.CapacityRange{RequiredBytes: 20 * gb}, codes.OutOfRange},
+		{"limit too small", &csi.CapacityRange{LimitBytes: 5 * gb}, codes.OutOfRange},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &fixedOfferingConnector{Interface: fake.New(), sizeInGB: -1}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			res, err := cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name: "fixed-" + strconv.Itoa(i),
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &onlyVolumeCapAccessMode,
+				}},
+				CapacityRange: c.capRange,
+				Parameters:    map[string]string{DiskOfferingKey: "fixed"},
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if connector.sizeInGB != 0 {
+				t.Errorf("Expected the volume to be created without a size, got %d GB", connector.sizeInGB)
+			}
+			if capacity := res.GetVolume().GetCapacityBytes(); capacity != 10*gb {
+				t.Errorf("Expected the capacity of the offering, got %d", capacity)
+			}
+		})
+	}
+}
+
+// iopsOfferingConnector is a fake connector with a disk offering
+// with customized IOPS, which records the IOPS of created volumes.
+type iopsOfferingConnector struct {
+	cloud.Interface
+	minIOPS, maxIOPS int64
+}
+
+func (c *iopsOfferingConnector) GetDiskOfferingByID(ctx context.Context, id string) (*cloud.DiskOffering, error) {
+	if id != "iops" {
+		return c.Interface.GetDiskOfferingByID(ctx, id)
+	}
+	return &cloud.DiskOffering{
+		ID:             "iops",
+		Name:           "Custom IOPS",
+		StorageType:    "shared",
+		Customized:     true,
+		CustomizedIOPS: true,
+	}, nil
+}
+
+func (c *iopsOfferingConnector) CreateVolume(ctx context.Context, diskOfferingID, zoneID, name string, sizeInGB, minIOPS, maxIOPS int64) (string, error) {
+	c.minIOPS, c.maxIOPS = minIOPS, maxIOPS
+	return c.Interface.CreateVolume(ctx, diskOfferingID, zoneID, name, sizeInGB, minIOPS, maxIOPS)
+}
+
+func TestCreateVolumeIOPS(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	cases := []struct {
+		name         string
+		parameters   map[string]string
+		expectedCode codes.Code
+		expectedMin  int64
+		expectedMax  int64
+	}{
+		{"no IOPS", map[string]string{DiskOfferingKey: "iops"}, codes.OK, 0, 0},
+		{"min and max", map[string]string{DiskOfferingKey: "iops", MinIOPSKey: "100", MaxIOPSKey: "500"}, codes.OK, 100, 500},
+		{"per GB", map[string]string{DiskOfferingKey: "iops", IOPSPerGBKey: "10", MaxIOPSKey: "500"}, codes.OK, 200, 500},
+		{"invalid", map[string]string{DiskOfferingKey: "iops", MinIOPSKey: "-1", MaxIOPSKey: "500"}, codes.InvalidArgument, 0, 0},
+		{"min only", map[string]string{DiskOfferingKey: "iops", MinIOPSKey: "100"}, codes.InvalidArgument, 0, 0},
+		{"max only", map[string]string{DiskOfferingKey: "iops", MaxIOPSKey: "500"}, codes.InvalidArgument, 0, 0},
+		{"offering without custom IOPS", map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c", MinIOPSKey: "100", MaxIOPSKey: "500"}, codes.InvalidArgument, 0, 0},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &iopsOfferingConnector{Interface: fake.New()}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			req := &csi.CreateVolumeRequest{
+				Name: "iops-" + strconv.Itoa(i),
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &onlyVolumeCapAccessMode,
+				}},
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * gb},
+				Parameters:    c.parameters,
+			}
+			_, err := cs.CreateVolume(context.Background(), req)
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if connector.minIOPS != c.expectedMin || connector.maxIOPS != c.expectedMax {
+				t.Errorf("Expected IOPS %d-%d, got %d-%d", c.expectedMin, c.expectedMax, connector.minIOPS, connector.maxIOPS)
+			}
+
+			// Same request again: the existing volume is suitable.
+			if _, err := cs.CreateVolume(context.Background(), req); err != nil {
+				t.Errorf("Expected idempotent creation, got %v", err)
+			}
+
+			// Same name with other IOPS: not suitable.
+			if c.expectedMin > 0 {
+				req.Parameters = map[string]string{DiskOfferingKey: "iops", MinIOPSKey: "50", MaxIOPSKey: "500"}
+				_, err := cs.CreateVolume(context.Background(), req)
+				if code := status.Code(err); code != codes.AlreadyExists {
+					t.Errorf("Expected code %v, got %v (%v)", codes.AlreadyExists, code, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateVolumeFromSnapshotIgnoresIOPS(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+	snap, err := connector.CreateSnapshot(ctx, "ace9f28b-3081-40c1-8353-4cc3e3014072", "snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The disk offering does not have customized IOPS,
+	// but IOPS parameters are ignored for snapshot sources.
+	_, err = cs.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: "restored",
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &onlyVolumeCapAccessMode,
+		}},
+		Parameters: map[string]string{
+			DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c",
+			MinIOPSKey:      "100",
+			MaxIOPSKey:      "500",
+		},
+		VolumeContentSource: &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: snap.ID},
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// tagVolumeRecorder is a fake connector which
+// records the volume given to TagVolume.
+type tagVolumeRecorder struct {
+	cloud.Interface
+	tagged *cloud.Volume
+}
+
+func (r *tagVolumeRecorder) TagVolume(ctx context.Context, vol *cloud.Volume, tags map[string]string) error {
+	r.tagged = vol
+	return r.Interface.TagVolume(ctx, vol, tags)
+}
+
+func TestCreateVolumeTags(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	cs := NewControllerServer(connector, "cluster-1", DefaultVolumeNamePrefix)
+	req := &csi.CreateVolumeRequest{
+		Name: "tagged",
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &onlyVolumeCapAccessMode,
+		}},
+		Parameters: map[string]string{
+			DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c",
+			pvcNameKey:      "data",
+			pvcNamespaceKey: "default",
+			pvNameKey:       "tagged",
+			"tag.team":      "storage",
+		},
+	}
+	res, err := cs.CreateVolume(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	vol, err := connector.GetVolumeByID(ctx, res.GetVolume().GetVolumeId())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		PVCNameTagKey:      "data",
+		PVCNamespaceTagKey: "default",
+		PVNameTagKey:       "tagged",
+		ClusterIDTagKey:    "cluster-1",
+		"team":             "storage",
+	}
+	if !reflect.DeepEqual(vol.Tags, expected) {
+		t.Errorf("Expected tags %v, got %v", expected, vol.Tags)
+	}
+
+	// Same request again: the existing volume is tagged with
+	// the tags it was listed with, without looking it up again.
+	recorder := &tagVolumeRecorder{Interface: connector}
+	cs = NewControllerServer(recorder, "cluster-1", DefaultVolumeNamePrefix)
+	if _, err := cs.CreateVolume(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if recorder.tagged == nil || !reflect.DeepEqual(recorder.tagged.Tags, expected) {
+		t.Errorf("Expected the existing volume with tags %v, got %+v", expected, recorder.tagged)
+	}
+
+	req.Parameters["tag."] = "invalid"
+	if _, err := cs.CreateVolume(ctx, req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected code %v, got %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+	volumeID := "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	otherVolumeID, err := connector.CreateVolume(ctx, "offering", "zone", "other", 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cs.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: volumeID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	snap := res.GetSnapshot()
+	if snap.GetSourceVolumeId() != volumeID || !snap.GetReadyToUse() {
+		t.Errorf("Unexpected snapshot %v", snap)
+	}
+
+	// Same name and source volume: the existing snapshot is returned
+	res, err = cs.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: volumeID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.GetSnapshot().GetSnapshotId() != snap.GetSnapshotId() {
+		t.Errorf("Expected snapshot %v, got %v", snap.GetSnapshotId(), res.GetSnapshot().GetSnapshotId())
+	}
+
+	// Same name, other source volume
+	_, err = cs.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: otherVolumeID})
+	if code := status.Code(err); code != codes.AlreadyExists {
+		t.Errorf("Expected code %v, got %v (%v)", codes.AlreadyExists, code, err)
+	}
+
+	// Source volume which does not exist
+	_, err = cs.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: "snap-2", SourceVolumeId: "unknown"})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("Expected code %v, got %v (%v)", codes.NotFound, code, err)
+	}
+
+	if _, err := cs.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snap.GetSnapshotId()}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Deleting again succeeds
+	if _, err := cs.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snap.GetSnapshotId()}); err != nil {
+		t.Errorf("Expected idempotent deletion, got %v", err)
+	}
+}
+
+func TestListSnapshotsPagination(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	volumeID := "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	for i := 0; i < 5; i++ {
+		if _, err := connector.CreateSnapshot(ctx, volumeID, "snap-"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+
+	cases := []struct {
+		name              string
+		startingToken     string
+		maxEntries        int32
+		expectedCode      codes.Code
+		expectedEntries   int
+		expectedNextToken string
+	}{
+		{"all", "", 0, codes.OK, 5, ""},
+		{"first page", "", 2, codes.OK, 2, "2"},
+		{"middle", "2", 2, codes.OK, 2, "4"},
+		{"last page", "4", 2, codes.OK, 1, ""},
+		{"invalid token", "abc", 2, codes.Aborted, 0, ""},
+		{"negative token", "-1", 2, codes.Aborted, 0, ""},
+		{"token beyond the end", "6", 2, codes.Aborted, 0, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := cs.ListSnapshots(ctx, &csi.ListSnapshotsRequest{
+				StartingToken: c.startingToken,
+				MaxEntries:    c.maxEntries,
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if len(resp.GetEntries()) != c.expectedEntries {
+				t.Errorf("Expected %v entries, got %v", c.expectedEntries, len(resp.GetEntries()))
+			}
+			if resp.GetNextToken() != c.expectedNextToken {
+				t.Errorf("Expected next token %q, got %q", c.expectedNextToken, resp.GetNextToken())
+			}
+		})
+	}
+}
+
+// cloneConnector is a fake connector which counts created
+// snapshots, and may report snapshots as not ready.
+type cloneConnector struct {
+	cloud.Interface
+	createdSnapshots int
+	snapshotState    string
+}
+
+func (c *cloneConnector) CreateSnapshot(ctx context.Context, volumeID, name string) (*cloud.Snapshot, error) {
+	c.createdSnapshots++
+	return c.Interface.CreateSnapshot(ctx, volumeID, name)
+}
+
+func (c *cloneConnector) GetSnapshotByName(ctx context.Context, name string) (*cloud.Snapshot, error) {
+	snap, err := c.Interface.GetSnapshotByName(ctx, name)
+	if err == nil && c.snapshotState != "" {
+		snap.State = c.snapshotState
+	}
+	return snap, err
+}
+
+func TestCreateVolumeClone(t *testing.T) {
+	const sourceVolumeID = "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	cases := []struct {
+		name                     string
+		existingSnapshotVolumeID string
+		snapshotState            string
+		capRange                 *csi.CapacityRange
+		expectedCode             codes.Code
+		expectedCreatedSnapshots int
+		expectSnapshotKept       bool
+	}{
+		{name: "new snapshot", expectedCode: codes.OK, expectedCreatedSnapshots: 1},
+		{name: "reused snapshot", existingSnapshotVolumeID: sourceVolumeID, expectedCode: codes.OK},
+		{name: "snapshot of another volume", existingSnapshotVolumeID: "other", expectedCode: codes.AlreadyExists, expectSnapshotKept: true},
+		{name: "snapshot not ready", existingSnapshotVolumeID: sourceVolumeID, snapshotState: "Creating", expectedCode: codes.Unavailable, expectSnapshotKept: true},
+		{name: "cleanup on error", capRange: &csi.CapacityRange{RequiredBytes: 1024 * 1024 * 1024}, expectedCode: codes.OutOfRange, expectedCreatedSnapshots: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			fakeConnector := fake.New()
+			if c.existingSnapshotVolumeID != "" {
+				volumeID := c.existingSnapshotVolumeID
+				if volumeID != sourceVolumeID {
+					var err error
+					if volumeID, err = fakeConnector.CreateVolume(ctx, "offering", "zone", volumeID, 1, 0, 0); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := fakeConnector.CreateSnapshot(ctx, volumeID, cloneSnapshotPrefix+"clone"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			connector := &cloneConnector{Interface: fakeConnector, snapshotState: c.snapshotState}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			_, err := cs.CreateVolume(ctx, &csi.CreateVolumeRequest{
+				Name: "clone",
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &onlyVolumeCapAccessMode,
+				}},
+				CapacityRange: c.capRange,
+				Parameters:    map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c"},
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Volume{
+						Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: sourceVolumeID},
+					},
+				},
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if connector.createdSnapshots != c.expectedCreatedSnapshots {
+				t.Errorf("Expected %d created snapshots, got %d", c.expectedCreatedSnapshots, connector.createdSnapshots)
+			}
+			_, err = fakeConnector.GetSnapshotByName(ctx, cloneSnapshotPrefix+"clone")
+			if kept := err == nil; kept != c.expectSnapshotKept {
+				t.Errorf("Expected snapshot kept=%v, got %v", c.expectSnapshotKept, kept)
+			}
+		})
+	}
+}
+
+func TestControllerExpandVolume(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	mountCap := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}}
+	blockCap := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}}
+	cases := []struct {
+		name             string
+		volumeID         string
+		capRange         *csi.CapacityRange
+		volumeCapability *csi.VolumeCapability
+		expectedCode     codes.Code
+		expectedCapacity int64
+	}{
+		{"missing volume ID", "", &csi.CapacityRange{RequiredBytes: 2 * gb}, mountCap, codes.InvalidArgument, 0},
+		{"missing capacity range", "vol", nil, mountCap, codes.InvalidArgument, 0},
+		{"limit too small", "vol", &csi.CapacityRange{RequiredBytes: 2 * gb, LimitBytes: gb}, mountCap, codes.OutOfRange, 0},
+		{"unknown volume", "unknown", &csi.CapacityRange{RequiredBytes: 2 * gb}, mountCap, codes.NotFound, 0},
+		{"expand", "vol", &csi.CapacityRange{RequiredBytes: 3 * gb}, mountCap, codes.OK, 3 * gb},
+		{"expand block volume", "vol", &csi.CapacityRange{RequiredBytes: 3 * gb}, blockCap, codes.OK, 3 * gb},
+		{"already large enough", "vol", &csi.CapacityRange{RequiredBytes: gb}, mountCap, codes.OK, 2 * gb},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			connector := fake.New()
+			volumeID, err := connector.CreateVolume(ctx, "offering", "zone", "expand", 2, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.volumeID != "vol" {
+				volumeID = c.volumeID
+			}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			res, err := cs.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+				VolumeId:         volumeID,
+				CapacityRange:    c.capRange,
+				VolumeCapability: c.volumeCapability,
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if res.GetCapacityBytes() != c.expectedCapacity {
+				t.Errorf("Expected capacity %d, got %d", c.expectedCapacity, res.GetCapacityBytes())
+			}
+			if !res.GetNodeExpansionRequired() {
+				t.Error("Expected node expansion to be required")
+			}
+			vol, err := connector.GetVolumeByID(ctx, volumeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vol.Size != c.expectedCapacity {
+				t.Errorf("Expected volume size %d, got %d", c.expectedCapacity, vol.Size)
+			}
+		})
+	}
+}
+
+// capacityConnector is a fake connector with given storage
+// pools capacity and available primary storage. It records
+// the zone and host of the last pools capacity request.
+type capacityConnector struct {
+	cloud.Interface
+	poolsCapacity int64
+	poolsErr      error
+	available     int64
+	zoneID        string
+	hostID        string
+}
+
+func (c *capacityConnector) GetStoragePoolsCapacity(ctx context.Context, zoneID, hostID string, offering *cloud.DiskOffering) (int64, error) {
+	c.zoneID, c.hostID = zoneID, hostID
+	return c.poolsCapacity, c.poolsErr
+}
+
+func (c *capacityConnector) GetAvailablePrimaryStorage(ctx context.Context) (int64, error) {
+	return c.available, nil
+}
+
+func TestGetCapacity(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	cases := []struct {
+		name             string
+		poolsCapacity    int64
+		poolsErr         error
+		available        int64
+		expectedCode     codes.Code
+		expectedCapacity int64
+	}{
+		{"pools", 100 * gb, nil, cloud.UnlimitedCapacity, codes.OK, 100 * gb},
+		{"account limit", 100 * gb, nil, 20 * gb, codes.OK, 20 * gb},
+		{"non-admin account", 0, cloud.ErrUnauthorized, 20 * gb, codes.OK, 20 * gb},
+		{"non-admin account without limit", 0, cloud.ErrUnauthorized, cloud.UnlimitedCapacity, codes.OK, math.MaxInt64},
+		{"pools error", 0, cloud.ErrRateLimited, 20 * gb, codes.ResourceExhausted, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &capacityConnector{
+				Interface:     fake.New(),
+				poolsCapacity: c.poolsCapacity,
+				poolsErr:      c.poolsErr,
+				available:     c.available,
+			}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			res, err := cs.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+				Parameters: map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c"},
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if res.GetAvailableCapacity() != c.expectedCapacity {
+				t.Errorf("Expected capacity %d, got %d", c.expectedCapacity, res.GetAvailableCapacity())
+			}
+		})
+	}
+}
+
+func TestGetCapacityTopology(t *testing.T) {
+	cases := []struct {
+		name           string
+		segments       map[string]string
+		expectedZoneID string
+		expectedHostID string
+	}{
+		{"zone", map[string]string{ZoneKey: "zone-1"}, "zone-1", ""},
+		{"zone and host", map[string]string{ZoneKey: "zone-1", HostKey: "host-1"}, "zone-1", "host-1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &capacityConnector{Interface: fake.New(), available: cloud.UnlimitedCapacity}
+			cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+			_, err := cs.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+				Parameters:         map[string]string{DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c"},
+				AccessibleTopology: &csi.Topology{Segments: c.segments},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if connector.zoneID != c.expectedZoneID || connector.hostID != c.expectedHostID {
+				t.Errorf("Expected zone %q and host %q, got %q and %q", c.expectedZoneID, c.expectedHostID, connector.zoneID, connector.hostID)
+			}
+		})
+	}
+}
+
+// deleteConnector is a fake connector whose
+// deletions return the given error.
+type deleteConnector struct {
+	cloud.Interface
+	err error
+}
+
+func (c *deleteConnector) DeleteVolume(ctx context.Context, id string) error {
+	return c.err
+}
+
+func (c *deleteConnector) DeleteSnapshot(ctx context.Context, id string) error {
+	return c.err
+}
+
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		name                 string
+		err                  error
+		expectedVolumeCode   codes.Code
+		expectedSnapshotCode codes.Code
+	}{
+		{"deleted", nil, codes.OK, codes.OK},
+		{"not found", fmt.Errorf("volume: %w", cloud.ErrNotFound), codes.OK, codes.OK},
+		{"attached", fmt.Errorf("not attached to any VM: %w", cloud.ErrInvalidParameter), codes.FailedPrecondition, codes.InvalidArgument},
+		{"rate limited", cloud.ErrRateLimited, codes.ResourceExhausted, codes.ResourceExhausted},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cs := NewControllerServer(&deleteConnector{Interface: fake.New(), err: c.err}, "", DefaultVolumeNamePrefix)
+			_, err := cs.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+			if code := status.Code(err); code != c.expectedVolumeCode {
+				t.Errorf("Expected volume deletion code %v, got %v (%v)", c.expectedVolumeCode, code, err)
+			}
+			_, err = cs.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-1"})
+			if code := status.Code(err); code != c.expectedSnapshotCode {
+				t.Errorf("Expected snapshot deletion code %v, got %v (%v)", c.expectedSnapshotCode, code, err)
+			}
+		})
+	}
+}
+
+func TestDeleteIdempotent(t *testing.T) {
+	ctx := context.Background()
+	connector := fake.New()
+	snap, err := connector.CreateSnapshot(ctx, "ace9f28b-3081-40c1-8353-4cc3e3014072", "snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewControllerServer(connector, "", DefaultVolumeNamePrefix)
+
+	for _, name := range []string{"existing", "deleted", "unknown"} {
+		volumeID, snapshotID := "ace9f28b-3081-40c1-8353-4cc3e3014072", snap.ID
+		if name == "unknown" {
+			volumeID, snapshotID = "unknown", "unknown"
+		}
+		t.Run(name, func(t *testing.T) {
+			if _, err := cs.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapshotID}); err != nil {
+				t.Errorf("Unexpected snapshot deletion error: %v", err)
+			}
+			if _, err := cs.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeID}); err != nil {
+				t.Errorf("Unexpected volume deletion error: %v", err)
+			}
+		})
+	}
+	if _, err := connector.GetVolumeByID(ctx, "ace9f28b-3081-40c1-8353-4cc3e3014072"); !errors.Is(err, cloud.ErrNotFound) {
+		t.Errorf("Expected the volume to be deleted, got %v", err)
+	}
+	if _, err := connector.GetSnapshotByID(ctx, snap.ID); !errors.Is(err, cloud.ErrNotFound) {
+		t.Errorf("Expected the snapshot to be deleted, got %v", err)
+	}
+}
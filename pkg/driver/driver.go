@@ -4,6 +4,9 @@
 package driver
 
 import (
+	"net/http"
+	"time"
+
 	"go.uber.org/zap"
 
 	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
@@ -14,34 +17,67 @@ import (
 type Interface interface {
 	// Run the CSI driver gRPC server
 	Run() error
+
+	// Healthz returns the HTTP handler of liveness probes
+	Healthz() http.Handler
+
+	// Readyz returns the HTTP handler of readiness probes,
+	// which reports the connectivity to the CloudStack API
+	Readyz() http.Handler
 }
 
 type cloudstackDriver struct {
-	endpoint string
-	nodeName string
-	version  string
+	endpoint          string
+	nodeName          string
+	clusterID         string
+	volumeNamePrefix  string
+	version           string
+	maxVolumesPerNode int64
 
 	connector cloud.Interface
 	mounter   mount.Interface
+	health    *healthChecker
 	logger    *zap.Logger
 }
 
-// New instantiates a new CloudStack CSI driver
-func New(endpoint string, csConnector cloud.Interface, mounter mount.Interface, nodeName string, version string, logger *zap.Logger) (Interface, error) {
+// New instantiates a new CloudStack CSI driver.
+//
+// If healthCheckInterval is positive, the connectivity to the CloudStack
+// API is checked at most once per interval by Probe and readiness probes.
+//
+// If clusterID is not empty, it is set as a resource tag on volumes.
+// volumeNamePrefix is the name prefix of the volumes created by the
+// external-provisioner, which identifies them if there is no clusterID.
+func New(endpoint string, csConnector cloud.Interface, mounter mount.Interface, nodeName string, maxVolumesPerNode int64, healthCheckInterval time.Duration, clusterID, volumeNamePrefix, version string, logger *zap.Logger) (Interface, error) {
 	return &cloudstackDriver{
-		endpoint:  endpoint,
-		nodeName:  nodeName,
-		version:   version,
-		connector: csConnector,
-		mounter:   mounter,
-		logger:    logger,
+		endpoint:          endpoint,
+		nodeName:          nodeName,
+		clusterID:         clusterID,
+		volumeNamePrefix:  volumeNamePrefix,
+		version:           version,
+		maxVolumesPerNode: maxVolumesPerNode,
+		connector:         csConnector,
+		mounter:           mounter,
+		health:            newHealthChecker(csConnector, healthCheckInterval),
+		logger:            logger,
 	}, nil
 }
 
 func (cs *cloudstackDriver) Run() error {
-	ids := NewIdentityServer(cs.version)
-	ctrls := NewControllerServer(cs.connector)
-	ns := NewNodeServer(cs.connector, cs.mounter, cs.nodeName)
+	// Start the initial health check
+	_, _ = cs.health.status()
+
+	ids := newIdentityServer(cs.version, cs.health)
+	ctrls := NewControllerServer(cs.connector, cs.clusterID, cs.volumeNamePrefix)
+	ns := NewNodeServer(cs.connector, cs.mounter, cs.nodeName, cs.maxVolumesPerNode, cs.volumeNamePrefix)
 
 	return cs.serve(ids, ctrls, ns)
 }
+
+func (cs *cloudstackDriver) Healthz() http.Handler {
+	return http.HandlerFunc(serveLiveness)
+}
+
+func (cs *cloudstackDriver) Readyz() http.Handler {
+	return cs.health
+}
@@ -0,0 +1,31 @@
+package driver
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+)
+
+// cloudErrorCode gives the gRPC status code corresponding to an
+// error of the CloudStack connector, so that sidecars back off and
+// retry appropriately.
+func cloudErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, cloud.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, cloud.ErrInvalidParameter):
+		return codes.InvalidArgument
+	case errors.Is(err, cloud.ErrUnsupported):
+		return codes.Unimplemented
+	case errors.Is(err, cloud.ErrLimitExceeded), errors.Is(err, cloud.ErrRateLimited):
+		return codes.ResourceExhausted
+	case errors.Is(err, cloud.ErrConcurrentOperation):
+		return codes.Aborted
+	case errors.Is(err, cloud.ErrUnauthorized):
+		return codes.Unauthenticated
+	default:
+		return codes.Internal
+	}
+}
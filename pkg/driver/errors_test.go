@@ -0,0 +1,32 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+)
+
+func TestCloudErrorCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected codes.Code
+	}{
+		{cloud.ErrNotFound, codes.NotFound},
+		{fmt.Errorf("wrapped: %w", cloud.ErrInvalidParameter), codes.InvalidArgument},
+		{cloud.ErrUnsupported, codes.Unimplemented},
+		{cloud.ErrLimitExceeded, codes.ResourceExhausted},
+		{fmt.Errorf("%w: ListVolumes", cloud.ErrRateLimited), codes.ResourceExhausted},
+		{cloud.ErrConcurrentOperation, codes.Aborted},
+		{cloud.ErrUnauthorized, codes.Unauthenticated},
+		{errors.New("other"), codes.Internal},
+	}
+	for _, c := range cases {
+		if code := cloudErrorCode(c.err); code != c.expected {
+			t.Errorf("%v: expected %v, got %v", c.err, c.expected, code)
+		}
+	}
+}
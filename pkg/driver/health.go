@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+)
+
+// healthCheckTimeout is the timeout of a CloudStack API health check.
+const healthCheckTimeout = 30 * time.Second
+
+// healthChecker checks the connectivity to the CloudStack API,
+// at most once per interval, in the background so that probes
+// never wait for CloudStack.
+//
+// A nil *healthChecker does not check anything and is always healthy.
+type healthChecker struct {
+	connector cloud.Interface
+	interval  time.Duration
+
+	mu        sync.Mutex
+	checked   bool // a check has completed
+	running   bool // a check is in progress
+	lastCheck time.Time
+	err       error
+}
+
+// newHealthChecker creates a health checker, or returns
+// nil if interval is not positive.
+func newHealthChecker(connector cloud.Interface, interval time.Duration) *healthChecker {
+	if interval <= 0 {
+		return nil
+	}
+	return &healthChecker{
+		connector: connector,
+		interval:  interval,
+	}
+}
+
+// status returns the result of the last check, and starts a new check
+// if the last one is older than the interval. It is not ready until the
+// first check has completed.
+func (h *healthChecker) status() (ready bool, err error) {
+	if h == nil {
+		return true, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.running && (!h.checked || time.Since(h.lastCheck) >= h.interval) {
+		h.running = true
+		go h.check()
+	}
+	if !h.checked {
+		return false, nil
+	}
+	return h.err == nil, h.err
+}
+
+func (h *healthChecker) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	_, err := h.connector.ListZonesID(ctx)
+	if err != nil {
+		err = fmt.Errorf("CloudStack API check failed: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checked = true
+	h.running = false
+	h.lastCheck = time.Now()
+	h.err = err
+}
+
+// ServeHTTP responds to readiness probes: 200 if healthy,
+// 503 if not ready yet or unhealthy.
+func (h *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ready, err := h.status()
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case !ready:
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// serveLiveness responds to liveness probes. The process is alive as long
+// as it responds: CloudStack API failures must not get it restarted.
+func serveLiveness(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
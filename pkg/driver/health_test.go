@@ -0,0 +1,125 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+)
+
+// zonesConnector is a fake connector whose ListZonesID
+// waits for a result to be sent on a channel.
+type zonesConnector struct {
+	cloud.Interface
+	results chan error
+}
+
+func (c *zonesConnector) ListZonesID(ctx context.Context) ([]string, error) {
+	return []string{"zone-1"}, <-c.results
+}
+
+// waitStatus waits for the health checker to complete a check.
+func waitStatus(t *testing.T, h *healthChecker) (bool, error) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		h.mu.Lock()
+		done := h.checked && !h.running
+		h.mu.Unlock()
+		if done {
+			return h.status()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Health check did not complete")
+	return false, nil
+}
+
+func TestHealthChecker(t *testing.T) {
+	connector := &zonesConnector{results: make(chan error, 1)}
+	h := newHealthChecker(connector, time.Hour)
+	ids := newIdentityServer("v0", h)
+	ctx := context.Background()
+
+	// Not ready while the initial check is pending
+	res, err := ids.Probe(ctx, &csi.ProbeRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.GetReady().GetValue() {
+		t.Error("Expected not ready before the initial check")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+
+	connector.results <- nil
+	if ready, err := waitStatus(t, h); !ready || err != nil {
+		t.Errorf("Expected ready, got %v, %v", ready, err)
+	}
+	res, err = ids.Probe(ctx, &csi.ProbeRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !res.GetReady().GetValue() {
+		t.Error("Expected ready")
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+
+	// Force the next check, which fails
+	h.mu.Lock()
+	h.lastCheck = time.Time{}
+	h.mu.Unlock()
+	connector.results <- cloud.ErrUnauthorized
+	_, _ = h.status()
+	if _, err := waitStatus(t, h); !errors.Is(err, cloud.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if _, err = ids.Probe(ctx, &csi.ProbeRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+
+	// The process is still alive
+	rec = httptest.NewRecorder()
+	serveLiveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected liveness status 200, got %d", rec.Code)
+	}
+}
+
+func TestHealthCheckerDisabled(t *testing.T) {
+	h := newHealthChecker(&zonesConnector{}, 0)
+	if h != nil {
+		t.Fatal("Expected a nil health checker")
+	}
+	res, err := newIdentityServer("v0", h).Probe(context.Background(), &csi.ProbeRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !res.GetReady().GetValue() {
+		t.Error("Expected ready")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
@@ -6,17 +6,26 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type identityServer struct {
 	csi.UnimplementedIdentityServer
 	version string
+	health  *healthChecker
 }
 
 // NewIdentityServer creates a new Identity gRPC server.
 func NewIdentityServer(version string) csi.IdentityServer {
+	return newIdentityServer(version, nil)
+}
+
+// newIdentityServer creates a new Identity gRPC server
+// whose Probe reports the status of the given health checker.
+func newIdentityServer(version string, health *healthChecker) *identityServer {
 	return &identityServer{
 		version: version,
+		health:  health,
 	}
 }
 
@@ -32,7 +41,13 @@ func (ids *identityServer) GetPluginInfo(ctx context.Context, req *csi.GetPlugin
 }
 
 func (ids *identityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	return &csi.ProbeResponse{}, nil
+	ready, err := ids.health.status()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &csi.ProbeResponse{
+		Ready: wrapperspb.Bool(ready),
+	}, nil
 }
 
 func (ids *identityServer) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
@@ -52,6 +67,13 @@ func (ids *identityServer) GetPluginCapabilities(ctx context.Context, req *csi.G
 					},
 				},
 			},
+			{
+				Type: &csi.PluginCapability_VolumeExpansion_{
+					VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
+						Type: csi.PluginCapability_VolumeExpansion_ONLINE,
+					},
+				},
+			},
 		},
 	}, nil
 }
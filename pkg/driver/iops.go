@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// volumeIOPS holds the IOPS requested in volume parameters,
+// for disk offerings with customized IOPS.
+type volumeIOPS struct {
+	min   int64
+	max   int64
+	perGB float64
+}
+
+// parseVolumeIOPS reads and validates the IOPS volume parameters.
+func parseVolumeIOPS(parameters map[string]string) (volumeIOPS, error) {
+	var iops volumeIOPS
+	var err error
+	if v := parameters[MinIOPSKey]; v != "" {
+		if iops.min, err = strconv.ParseInt(v, 10, 64); err != nil || iops.min <= 0 {
+			return volumeIOPS{}, fmt.Errorf("invalid parameter %v=%q: must be a positive integer", MinIOPSKey, v)
+		}
+	}
+	if v := parameters[MaxIOPSKey]; v != "" {
+		if iops.max, err = strconv.ParseInt(v, 10, 64); err != nil || iops.max <= 0 {
+			return volumeIOPS{}, fmt.Errorf("invalid parameter %v=%q: must be a positive integer", MaxIOPSKey, v)
+		}
+	}
+	if v := parameters[IOPSPerGBKey]; v != "" {
+		if iops.perGB, err = strconv.ParseFloat(v, 64); err != nil || iops.perGB <= 0 {
+			return volumeIOPS{}, fmt.Errorf("invalid parameter %v=%q: must be a positive number", IOPSPerGBKey, v)
+		}
+		if iops.min > 0 {
+			return volumeIOPS{}, fmt.Errorf("parameters %v and %v are mutually exclusive", MinIOPSKey, IOPSPerGBKey)
+		}
+	}
+	// CloudStack needs both bounds of customized IOPS
+	if (iops.min > 0 || iops.perGB > 0) && iops.max == 0 {
+		return volumeIOPS{}, fmt.Errorf("parameter %v is required with %v or %v", MaxIOPSKey, MinIOPSKey, IOPSPerGBKey)
+	}
+	if iops.max > 0 && iops.min == 0 && iops.perGB == 0 {
+		return volumeIOPS{}, fmt.Errorf("parameter %v requires %v or %v", MaxIOPSKey, MinIOPSKey, IOPSPerGBKey)
+	}
+	if iops.min > iops.max {
+		return volumeIOPS{}, fmt.Errorf("parameter %v=%d is greater than %v=%d", MinIOPSKey, iops.min, MaxIOPSKey, iops.max)
+	}
+	return iops, nil
+}
+
+// isSet checks whether any IOPS parameter is set.
+func (v volumeIOPS) isSet() bool {
+	return v.min > 0 || v.max > 0 || v.perGB > 0
+}
+
+// forSize gives the min and max IOPS of a volume of the given size.
+// The min IOPS given by the ratio per GB is capped by the max IOPS.
+// Zero values are not set.
+func (v volumeIOPS) forSize(sizeInGB int64) (min, max int64) {
+	min, max = v.min, v.max
+	if v.perGB > 0 {
+		min = int64(math.Ceil(v.perGB * float64(sizeInGB)))
+		if min > max {
+			min = max
+		}
+	}
+	return min, max
+}
@@ -0,0 +1,67 @@
+package driver
+
+import (
+	"testing"
+)
+
+func TestParseVolumeIOPS(t *testing.T) {
+	cases := []struct {
+		name        string
+		parameters  map[string]string
+		expected    volumeIOPS
+		expectError bool
+	}{
+		{"none", map[string]string{}, volumeIOPS{}, false},
+		{"min and max", map[string]string{MinIOPSKey: "100", MaxIOPSKey: "500"}, volumeIOPS{min: 100, max: 500}, false},
+		{"per GB and max", map[string]string{IOPSPerGBKey: "2.5", MaxIOPSKey: "500"}, volumeIOPS{max: 500, perGB: 2.5}, false},
+		{"invalid min", map[string]string{MinIOPSKey: "abc", MaxIOPSKey: "500"}, volumeIOPS{}, true},
+		{"zero max", map[string]string{MinIOPSKey: "100", MaxIOPSKey: "0"}, volumeIOPS{}, true},
+		{"negative per GB", map[string]string{IOPSPerGBKey: "-1", MaxIOPSKey: "500"}, volumeIOPS{}, true},
+		{"min and per GB", map[string]string{MinIOPSKey: "100", IOPSPerGBKey: "2", MaxIOPSKey: "500"}, volumeIOPS{}, true},
+		{"min only", map[string]string{MinIOPSKey: "100"}, volumeIOPS{}, true},
+		{"per GB only", map[string]string{IOPSPerGBKey: "2.5"}, volumeIOPS{}, true},
+		{"max only", map[string]string{MaxIOPSKey: "500"}, volumeIOPS{}, true},
+		{"min greater than max", map[string]string{MinIOPSKey: "600", MaxIOPSKey: "500"}, volumeIOPS{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			iops, err := parseVolumeIOPS(c.parameters)
+			if c.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", iops)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if iops != c.expected {
+				t.Errorf("Expected %+v, got %+v", c.expected, iops)
+			}
+		})
+	}
+}
+
+func TestVolumeIOPSForSize(t *testing.T) {
+	cases := []struct {
+		name        string
+		iops        volumeIOPS
+		sizeInGB    int64
+		expectedMin int64
+		expectedMax int64
+	}{
+		{"none", volumeIOPS{}, 10, 0, 0},
+		{"min and max", volumeIOPS{min: 100, max: 500}, 10, 100, 500},
+		{"per GB", volumeIOPS{max: 500, perGB: 2.5}, 11, 28, 500},
+		{"per GB capped", volumeIOPS{max: 500, perGB: 10}, 100, 500, 500},
+		{"per GB below max", volumeIOPS{max: 500, perGB: 10}, 20, 200, 500},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			min, max := c.iops.forSize(c.sizeInGB)
+			if min != c.expectedMin || max != c.expectedMax {
+				t.Errorf("Expected %d-%d, got %d-%d", c.expectedMin, c.expectedMax, min, max)
+			}
+		})
+	}
+}
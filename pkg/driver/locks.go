@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"context"
+	"sync"
+)
+
+// operationLocks serializes operations sharing a key,
+// such as a volume ID or a virtual machine ID.
+type operationLocks struct {
+	mu    sync.Mutex
+	locks map[string]*operationLock
+}
+
+type operationLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newOperationLocks() *operationLocks {
+	return &operationLocks{
+		locks: make(map[string]*operationLock),
+	}
+}
+
+// TryLock acquires the lock of a key if it is free,
+// and reports whether it was acquired.
+func (l *operationLocks) TryLock(key string) bool {
+	lock := l.get(key)
+	select {
+	case lock.ch <- struct{}{}:
+		return true
+	default:
+		l.put(key)
+		return false
+	}
+}
+
+// Lock acquires the lock of a key, waiting until
+// it is free or until the context is done.
+func (l *operationLocks) Lock(ctx context.Context, key string) error {
+	lock := l.get(key)
+	select {
+	case lock.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.put(key)
+		return ctx.Err()
+	}
+}
+
+// Unlock releases the lock of a key acquired
+// with TryLock or Lock.
+func (l *operationLocks) Unlock(key string) {
+	l.mu.Lock()
+	lock := l.locks[key]
+	l.mu.Unlock()
+	<-lock.ch
+	l.put(key)
+}
+
+// get returns the lock of a key, creating it if needed,
+// and registers a new user of the lock.
+func (l *operationLocks) get(key string) *operationLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &operationLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// put unregisters a user of the lock of a key,
+// deleting the lock when it has no more users.
+func (l *operationLocks) put(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock := l.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
@@ -0,0 +1,83 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOperationLocksTryLock(t *testing.T) {
+	l := newOperationLocks()
+	if !l.TryLock("a") {
+		t.Fatal("Expected lock of a to be acquired")
+	}
+	if l.TryLock("a") {
+		t.Error("Expected lock of a to be held")
+	}
+	if !l.TryLock("b") {
+		t.Error("Expected lock of b to be acquired")
+	}
+	l.Unlock("a")
+	l.Unlock("b")
+	if !l.TryLock("a") {
+		t.Error("Expected lock of a to be acquired after release")
+	}
+	l.Unlock("a")
+	if len(l.locks) != 0 {
+		t.Errorf("Expected no remaining lock, got %d", len(l.locks))
+	}
+}
+
+func TestOperationLocksLock(t *testing.T) {
+	l := newOperationLocks()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Lock(ctx, "vm"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			l.Unlock("vm")
+		}()
+	}
+	wg.Wait()
+	if maxRunning != 1 {
+		t.Errorf("Expected operations to run one at a time, got %d concurrent", maxRunning)
+	}
+	if len(l.locks) != 0 {
+		t.Errorf("Expected no remaining lock, got %d", len(l.locks))
+	}
+}
+
+func TestOperationLocksLockContext(t *testing.T) {
+	l := newOperationLocks()
+	if !l.TryLock("vm") {
+		t.Fatal("Expected lock to be acquired")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Lock(ctx, "vm"); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	l.Unlock("vm")
+	if len(l.locks) != 0 {
+		t.Errorf("Expected no remaining lock, got %d", len(l.locks))
+	}
+}
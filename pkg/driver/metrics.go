@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var requestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "cloudstack_csi",
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of CSI gRPC requests, by method and status code.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	},
+	[]string{"method", "code"},
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+// metricsUnaryServerInterceptor records the duration
+// and the status code of every gRPC request.
+func metricsUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	requestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,37 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetricsUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/TestMethod"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	// The histogram is global: only the new observations are counted
+	sampleCount := func() uint64 {
+		m := &dto.Metric{}
+		if err := requestDuration.WithLabelValues(info.FullMethod, codes.NotFound.String()).(prometheus.Metric).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	before := sampleCount()
+	for i := 0; i < 2; i++ {
+		if _, err := metricsUnaryServerInterceptor(context.Background(), nil, info, handler); status.Code(err) != codes.NotFound {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if count := sampleCount() - before; count != 2 {
+		t.Errorf("Expected 2 observations, got %d", count)
+	}
+}
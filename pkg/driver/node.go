@@ -2,9 +2,11 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
@@ -22,20 +24,28 @@ const (
 
 type nodeServer struct {
 	csi.UnimplementedNodeServer
-	connector cloud.Interface
-	mounter   mount.Interface
-	nodeName  string
+	connector         cloud.Interface
+	mounter           mount.Interface
+	nodeName          string
+	maxVolumesPerNode int64
+	volumeNamePrefix  string
 }
 
 // NewNodeServer creates a new Node gRPC server.
-func NewNodeServer(connector cloud.Interface, mounter mount.Interface, nodeName string) csi.NodeServer {
+//
+// If maxVolumesPerNode is zero, the maximum number of volumes
+// per node is determined from the hypervisor of the node, minus
+// the attached volumes whose name does not have volumeNamePrefix.
+func NewNodeServer(connector cloud.Interface, mounter mount.Interface, nodeName string, maxVolumesPerNode int64, volumeNamePrefix string) csi.NodeServer {
 	if mounter == nil {
 		mounter = mount.New()
 	}
 	return &nodeServer{
-		connector: connector,
-		mounter:   mounter,
-		nodeName:  nodeName,
+		connector:         connector,
+		mounter:           mounter,
+		nodeName:          nodeName,
+		maxVolumesPerNode: maxVolumesPerNode,
+		volumeNamePrefix:  volumeNamePrefix,
 	}
 }
 
@@ -284,11 +294,11 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	targetPath := req.GetTargetPath()
 
 	volumeID := req.GetVolumeId()
-	if _, err := ns.connector.GetVolumeByID(ctx, volumeID); err == cloud.ErrNotFound {
+	if _, err := ns.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
 	} else if err != nil {
 		// Error with CloudStack
-		return nil, status.Errorf(codes.Internal, "Error %v", err)
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
 	}
 
 	err := ns.mounter.Unmount(targetPath)
@@ -302,6 +312,159 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+	// Check arguments
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	volumeID := req.GetVolumeId()
+
+	if req.GetVolumePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume path missing in request")
+	}
+	volumePath := req.GetVolumePath()
+
+	if _, err := ns.connector.GetVolumeByID(ctx, volumeID); errors.Is(err, cloud.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Volume %v not found", volumeID)
+	} else if err != nil {
+		// Error with CloudStack
+		return nil, status.Errorf(cloudErrorCode(err), "Error %v", err)
+	}
+
+	devicePath, err := ns.mounter.GetDevicePath(ctx, volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Cannot find device path for volume %s: %s", volumeID, err.Error())
+	}
+
+	if err := ns.mounter.RescanDevice(ctx, devicePath); err != nil {
+		return nil, status.Errorf(codes.Internal, "Cannot rescan device %s: %s", devicePath, err.Error())
+	}
+
+	isBlock := req.GetVolumeCapability().GetBlock() != nil
+	if req.GetVolumeCapability() == nil {
+		// Without volume capability, guess the access type from the volume path
+		if fi, err := os.Stat(volumePath); err == nil {
+			isBlock = fi.Mode()&os.ModeDevice != 0
+		}
+	}
+
+	// Block volumes have no file system to resize
+	if !isBlock {
+		ctxzap.Extract(ctx).Sugar().Infow("Resizing file system",
+			"devicePath", devicePath,
+			"volumePath", volumePath,
+			"volumeID", volumeID,
+		)
+		if _, err := ns.mounter.ResizeFs(devicePath, volumePath); err != nil {
+			return nil, status.Errorf(codes.Internal, "Cannot resize file system on %s: %s", devicePath, err.Error())
+		}
+	}
+
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
+	}, nil
+}
+
+func (ns *nodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	// Check arguments
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	volumeID := req.GetVolumeId()
+
+	if req.GetVolumePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume path missing in request")
+	}
+	volumePath := req.GetVolumePath()
+
+	// Statistics are polled periodically by the kubelet: they come from
+	// the node only, without calling the CloudStack API.
+	fi, err := os.Stat(volumePath)
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "Volume path %s not found", volumePath)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "Cannot stat %s: %v", volumePath, err)
+	}
+	isBlock := fi.Mode()&os.ModeDevice != 0
+
+	var usage []*csi.VolumeUsage
+	if isBlock {
+		size, err := ns.mounter.GetBlockSizeBytes(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Cannot get size of block device %s: %v", volumePath, err)
+		}
+		usage = []*csi.VolumeUsage{
+			{
+				Unit:  csi.VolumeUsage_BYTES,
+				Total: size,
+			},
+		}
+	} else {
+		stats, err := ns.mounter.GetStatistics(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Cannot get statistics of %s: %v", volumePath, err)
+		}
+		usage = []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Available: stats.AvailableBytes,
+				Total:     stats.TotalBytes,
+				Used:      stats.UsedBytes,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Available: stats.AvailableInodes,
+				Total:     stats.TotalInodes,
+				Used:      stats.UsedInodes,
+			},
+		}
+	}
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage:           usage,
+		VolumeCondition: ns.volumeCondition(volumeID, volumePath),
+	}, nil
+}
+
+// volumeCondition checks that the device of a volume is
+// present, and that its volume path is still mounted.
+func (ns *nodeServer) volumeCondition(volumeID, volumePath string) *csi.VolumeCondition {
+	devicePath, err := ns.mounter.LookupDevicePath(volumeID)
+	if err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Cannot look up device of volume %s: %v", volumeID, err),
+		}
+	}
+	if devicePath == "" {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Device of volume %s not found in /dev/disk/by-id", volumeID),
+		}
+	}
+
+	notMnt, err := ns.mounter.IsLikelyNotMountPoint(volumePath)
+	if err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Cannot check mount point %s: %v", volumePath, err),
+		}
+	}
+	if notMnt {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume path %s is not a mount point", volumePath),
+		}
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "Volume is healthy",
+	}
+}
+
 func (ns *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	if ns.nodeName == "" {
 		return nil, status.Error(codes.Internal, "Missing node name")
@@ -309,7 +472,7 @@ func (ns *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoReque
 
 	vm, err := ns.connector.GetNodeInfo(ctx, ns.nodeName)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(cloudErrorCode(err), err.Error())
 	}
 	if vm.ID == "" {
 		return nil, status.Error(codes.Internal, "Node with no ID")
@@ -318,13 +481,58 @@ func (ns *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoReque
 		return nil, status.Error(codes.Internal, "Node zone ID not found")
 	}
 
-	topology := Topology{ZoneID: vm.ZoneID}
+	maxVolumes := ns.maxVolumesPerNode
+	if maxVolumes == 0 {
+		maxVolumes = ns.maxVolumesForVM(ctx, vm)
+	}
+
+	topology := Topology{ZoneID: vm.ZoneID, HostID: vm.HostID}
 	return &csi.NodeGetInfoResponse{
 		NodeId:             vm.ID,
 		AccessibleTopology: topology.ToCSI(),
+		MaxVolumesPerNode:  maxVolumes,
 	}, nil
 }
 
+// maxVolumesForVM determines the maximum number of volumes which
+// may be attached to a VM by the driver: the maximum number of data
+// volumes of its hypervisor, minus the data volumes already attached
+// and not provisioned through Kubernetes, i.e. whose name does not have
+// the name prefix of the volumes of the external-provisioner.
+//
+// It returns zero if the maximum cannot be determined.
+func (ns *nodeServer) maxVolumesForVM(ctx context.Context, vm *cloud.VM) int64 {
+	slog := ctxzap.Extract(ctx).Sugar()
+
+	limit, err := ns.connector.GetMaxDataVolumes(ctx, vm.Hypervisor)
+	if err != nil {
+		// Listing hypervisor capabilities requires root admin privileges
+		slog.Warnw("Cannot determine maximum number of data volumes; use option -max-volumes-per-node to set it",
+			"hypervisor", vm.Hypervisor, "error", err)
+		return 0
+	}
+
+	volumes, err := ns.connector.ListVolumesByVM(ctx, vm.ID)
+	if err != nil {
+		slog.Warnw("Cannot list data volumes attached to node", "vmID", vm.ID, "error", err)
+		return 0
+	}
+	var unmanaged int
+	for _, vol := range volumes {
+		if !strings.HasPrefix(vol.Name, ns.volumeNamePrefix) {
+			unmanaged++
+		}
+	}
+
+	available := int64(limit - unmanaged)
+	if available < 1 {
+		slog.Warnw("No data volume slot left for the driver", "limit", limit, "attached", unmanaged)
+		// Zero would mean no limit
+		available = 1
+	}
+	return available
+}
+
 func (ns *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
 	return &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
@@ -335,6 +543,27 @@ func (ns *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetC
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
 		},
 	}, nil
 }
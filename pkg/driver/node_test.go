@@ -0,0 +1,250 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud/fake"
+	"github.com/apalia/cloudstack-csi-driver/pkg/mount"
+)
+
+// attachedVolumesConnector is a fake connector with
+// given data volumes attached to every VM.
+type attachedVolumesConnector struct {
+	cloud.Interface
+	maxDataVolumes int
+	err            error
+	volumes        []cloud.Volume
+}
+
+func (c *attachedVolumesConnector) GetMaxDataVolumes(ctx context.Context, hypervisor string) (int, error) {
+	return c.maxDataVolumes, c.err
+}
+
+func (c *attachedVolumesConnector) ListVolumesByVM(ctx context.Context, vmID string) ([]cloud.Volume, error) {
+	return c.volumes, nil
+}
+
+func TestNodeGetInfoMaxVolumes(t *testing.T) {
+	cases := []struct {
+		name              string
+		maxVolumesPerNode int64
+		volumeNamePrefix  string
+		maxDataVolumes    int
+		err               error
+		volumes           []cloud.Volume
+		expected          int64
+	}{
+		{"hypervisor limit", 0, DefaultVolumeNamePrefix, 13, nil, nil, 13},
+		{"unmanaged volumes", 0, DefaultVolumeNamePrefix, 13, nil, []cloud.Volume{{Name: "data"}, {Name: "pvc-1234"}}, 12},
+		{"custom name prefix", 0, "k8s-", 13, nil, []cloud.Volume{{Name: "data"}, {Name: "pvc-1234"}, {Name: "k8s-1234"}}, 11},
+		{"no slot left", 0, DefaultVolumeNamePrefix, 2, nil, []cloud.Volume{{Name: "data-1"}, {Name: "data-2"}}, 1},
+		{"unknown limit", 0, DefaultVolumeNamePrefix, 0, errors.New("not allowed"), nil, 0},
+		{"override", 20, DefaultVolumeNamePrefix, 13, nil, []cloud.Volume{{Name: "data"}}, 20},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &attachedVolumesConnector{
+				Interface:      fake.New(),
+				maxDataVolumes: c.maxDataVolumes,
+				err:            c.err,
+				volumes:        c.volumes,
+			}
+			ns := NewNodeServer(connector, mount.NewFake(), "node", c.maxVolumesPerNode, c.volumeNamePrefix)
+			resp, err := ns.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.GetMaxVolumesPerNode() != c.expected {
+				t.Errorf("Expected %v, got %v", c.expected, resp.GetMaxVolumesPerNode())
+			}
+		})
+	}
+}
+
+// expandMounter is a fake mounter which records
+// rescanned devices and resized file systems.
+type expandMounter struct {
+	mount.Interface
+	rescanned []string
+	resized   []string
+}
+
+func (m *expandMounter) RescanDevice(ctx context.Context, devicePath string) error {
+	m.rescanned = append(m.rescanned, devicePath)
+	return nil
+}
+
+func (m *expandMounter) ResizeFs(devicePath, deviceMountPath string) (bool, error) {
+	m.resized = append(m.resized, devicePath)
+	return true, nil
+}
+
+func TestNodeExpandVolume(t *testing.T) {
+	const volumeID = "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	cases := []struct {
+		name             string
+		volumeID         string
+		volumePath       string
+		volumeCapability *csi.VolumeCapability
+		expectedCode     codes.Code
+		expectResize     bool
+	}{
+		{"missing volume ID", "", "/target", nil, codes.InvalidArgument, false},
+		{"missing volume path", volumeID, "", nil, codes.InvalidArgument, false},
+		{"unknown volume", "unknown", "/target", nil, codes.NotFound, false},
+		{"file system", volumeID, "/target", &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		}, codes.OK, true},
+		{"block", volumeID, "/target", &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		}, codes.OK, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mounter := &expandMounter{Interface: mount.NewFake()}
+			ns := NewNodeServer(fake.New(), mounter, "node", 0, DefaultVolumeNamePrefix)
+			res, err := ns.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+				VolumeId:         c.volumeID,
+				VolumePath:       c.volumePath,
+				VolumeCapability: c.volumeCapability,
+				CapacityRange:    &csi.CapacityRange{RequiredBytes: 1024},
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if res.GetCapacityBytes() != 1024 {
+				t.Errorf("Expected capacity 1024, got %d", res.GetCapacityBytes())
+			}
+			if len(mounter.rescanned) != 1 {
+				t.Errorf("Expected the device to be rescanned once, got %v", mounter.rescanned)
+			}
+			if resized := len(mounter.resized) > 0; resized != c.expectResize {
+				t.Errorf("Expected file system resized=%v, got %v", c.expectResize, resized)
+			}
+		})
+	}
+}
+
+func TestNodeGetVolumeStats(t *testing.T) {
+	const volumeID = "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	ctx := context.Background()
+	mountedPath := t.TempDir()
+	notMountedPath := t.TempDir()
+	mounter := mount.NewFake()
+	if err := mounter.Mount("/dev/sdb", mountedPath, "ext4", nil); err != nil {
+		t.Fatal(err)
+	}
+	// Block volumes are bind mounts of the device
+	if err := mounter.Mount("/dev/sdb", "/dev/null", "", []string{"bind"}); err != nil {
+		t.Fatal(err)
+	}
+	ns := NewNodeServer(fake.New(), mounter, "node", 0, DefaultVolumeNamePrefix)
+
+	cases := []struct {
+		name           string
+		volumeID       string
+		volumePath     string
+		expectedCode   codes.Code
+		expectedUsage  []*csi.VolumeUsage
+		expectAbnormal bool
+	}{
+		{"missing volume ID", "", mountedPath, codes.InvalidArgument, nil, false},
+		{"missing volume path", volumeID, "", codes.InvalidArgument, nil, false},
+		{"missing path", volumeID, filepath.Join(notMountedPath, "missing"), codes.NotFound, nil, false},
+		{"file system", volumeID, mountedPath, codes.OK, []*csi.VolumeUsage{
+			{Unit: csi.VolumeUsage_BYTES, Available: 3 * 1024 * 1024 * 1024, Total: 10 * 1024 * 1024 * 1024, Used: 7 * 1024 * 1024 * 1024},
+			{Unit: csi.VolumeUsage_INODES, Available: 3000, Total: 10000, Used: 7000},
+		}, false},
+		{"file system not mounted", volumeID, notMountedPath, codes.OK, []*csi.VolumeUsage{
+			{Unit: csi.VolumeUsage_BYTES, Available: 3 * 1024 * 1024 * 1024, Total: 10 * 1024 * 1024 * 1024, Used: 7 * 1024 * 1024 * 1024},
+			{Unit: csi.VolumeUsage_INODES, Available: 3000, Total: 10000, Used: 7000},
+		}, true},
+		{"block device", volumeID, "/dev/null", codes.OK, []*csi.VolumeUsage{
+			{Unit: csi.VolumeUsage_BYTES, Total: 10 * 1024 * 1024 * 1024},
+		}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := ns.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   c.volumeID,
+				VolumePath: c.volumePath,
+			})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(res.GetUsage()) != len(c.expectedUsage) {
+				t.Fatalf("Expected usage %v, got %v", c.expectedUsage, res.GetUsage())
+			}
+			for i, usage := range res.GetUsage() {
+				expected := c.expectedUsage[i]
+				if usage.GetUnit() != expected.GetUnit() || usage.GetTotal() != expected.GetTotal() ||
+					usage.GetAvailable() != expected.GetAvailable() || usage.GetUsed() != expected.GetUsed() {
+					t.Errorf("Expected usage %v, got %v", expected, usage)
+				}
+			}
+			if abnormal := res.GetVolumeCondition().GetAbnormal(); abnormal != c.expectAbnormal {
+				t.Errorf("Expected abnormal=%v, got %v (%s)", c.expectAbnormal, abnormal, res.GetVolumeCondition().GetMessage())
+			}
+		})
+	}
+}
+
+// volumeErrorConnector is a fake connector
+// whose volume lookups return the given error.
+type volumeErrorConnector struct {
+	cloud.Interface
+	err error
+}
+
+func (c *volumeErrorConnector) GetVolumeByID(ctx context.Context, volumeID string) (*cloud.Volume, error) {
+	return nil, c.err
+}
+
+func TestNodeVolumeLookupErrors(t *testing.T) {
+	const volumeID = "ace9f28b-3081-40c1-8353-4cc3e3014072"
+	ctx := context.Background()
+	cases := []struct {
+		name         string
+		err          error
+		expectedCode codes.Code
+	}{
+		{"wrapped not found", fmt.Errorf("volume %s: %w", volumeID, cloud.ErrNotFound), codes.NotFound},
+		{"rate limited", cloud.ErrRateLimited, codes.ResourceExhausted},
+		{"unauthorized", cloud.ErrUnauthorized, codes.Unauthenticated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ns := NewNodeServer(&volumeErrorConnector{Interface: fake.New(), err: c.err}, mount.NewFake(), "node", 0, DefaultVolumeNamePrefix)
+			path := t.TempDir()
+
+			_, err := ns.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: volumeID, TargetPath: path})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Errorf("NodeUnpublishVolume: expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+			_, err = ns.NodeExpandVolume(ctx, &csi.NodeExpandVolumeRequest{VolumeId: volumeID, VolumePath: path})
+			if code := status.Code(err); code != c.expectedCode {
+				t.Errorf("NodeExpandVolume: expected code %v, got %v (%v)", c.expectedCode, code, err)
+			}
+
+			// Statistics do not depend on the CloudStack API
+			if _, err = ns.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeID, VolumePath: path}); err != nil {
+				t.Errorf("NodeGetVolumeStats: unexpected error %v", err)
+			}
+		})
+	}
+}
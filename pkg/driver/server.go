@@ -33,9 +33,11 @@ func (cs *cloudstackDriver) serve(ids csi.IdentityServer, ctrls csi.ControllerSe
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	// Log every request and payloads (request + response)
+	// Log every request and payloads (request + response),
+	// and record request metrics
 	opts := []grpc.ServerOption{
 		grpc_middleware.WithUnaryServerChain(
+			metricsUnaryServerInterceptor,
 			grpc_zap.UnaryServerInterceptor(cs.logger),
 			grpc_zap.PayloadUnaryServerInterceptor(cs.logger, func(context.Context, string, interface{}) bool { return true }),
 		),
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// volumeTags gives the resource tags of a volume, from the Kubernetes
+// metadata and the extra tags of the volume parameters, and the ID of
+// the cluster if not empty.
+func volumeTags(parameters map[string]string, clusterID string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for key, value := range parameters {
+		if !strings.HasPrefix(key, tagParameterPrefix) {
+			continue
+		}
+		tagKey := strings.TrimPrefix(key, tagParameterPrefix)
+		if tagKey == "" {
+			return nil, fmt.Errorf("invalid parameter %q: missing tag key", key)
+		}
+		if strings.HasPrefix(tagKey, DriverName+"/") {
+			return nil, fmt.Errorf("invalid parameter %q: tag keys prefixed with %v/ are reserved", key, DriverName)
+		}
+		tags[tagKey] = value
+	}
+	for paramKey, tagKey := range map[string]string{
+		pvcNameKey:      PVCNameTagKey,
+		pvcNamespaceKey: PVCNamespaceTagKey,
+		pvNameKey:       PVNameTagKey,
+	} {
+		if value := parameters[paramKey]; value != "" {
+			tags[tagKey] = value
+		}
+	}
+	if clusterID != "" {
+		tags[ClusterIDTagKey] = clusterID
+	}
+	return tags, nil
+}
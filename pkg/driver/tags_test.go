@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVolumeTags(t *testing.T) {
+	cases := []struct {
+		name        string
+		parameters  map[string]string
+		clusterID   string
+		expected    map[string]string
+		expectError bool
+	}{
+		{"none", map[string]string{DiskOfferingKey: "offering-1"}, "", map[string]string{}, false},
+		{"metadata and cluster", map[string]string{
+			DiskOfferingKey: "offering-1",
+			pvcNameKey:      "data",
+			pvcNamespaceKey: "default",
+			pvNameKey:       "pvc-1234",
+		}, "cluster-1", map[string]string{
+			PVCNameTagKey:      "data",
+			PVCNamespaceTagKey: "default",
+			PVNameTagKey:       "pvc-1234",
+			ClusterIDTagKey:    "cluster-1",
+		}, false},
+		{"extra tags", map[string]string{"tag.team": "storage", "tag.env": "prod"}, "", map[string]string{
+			"team": "storage",
+			"env":  "prod",
+		}, false},
+		{"empty tag key", map[string]string{"tag.": "value"}, "", nil, true},
+		{"reserved tag key", map[string]string{"tag." + ClusterIDTagKey: "other"}, "", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tags, err := volumeTags(c.parameters, c.clusterID)
+			if c.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", tags)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tags, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestTopologyRoundTrip(t *testing.T) {
+	cases := []Topology{
+		{ZoneID: "zone-1"},
+		{ZoneID: "zone-1", HostID: "host-1"},
+	}
+	for _, c := range cases {
+		segments := c.ToCSI().GetSegments()
+		if segments[ZoneKey] != c.ZoneID {
+			t.Errorf("Expected zone segment %q, got %q", c.ZoneID, segments[ZoneKey])
+		}
+		if hostID, ok := segments[HostKey]; ok != (c.HostID != "") || hostID != c.HostID {
+			t.Errorf("Expected host segment %q, got %q", c.HostID, hostID)
+		}
+
+		res, err := NewTopology(c.ToCSI())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if res != c {
+			t.Errorf("Expected %+v, got %+v", c, res)
+		}
+	}
+}
+
+func TestNewTopologyErrors(t *testing.T) {
+	cases := []*csi.Topology{
+		nil,
+		{Segments: map[string]string{HostKey: "host-1"}},
+	}
+	for _, c := range cases {
+		if _, err := NewTopology(c); err == nil {
+			t.Errorf("Expected an error for %v", c)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package gc provides the logic used by command line tool cloudstack-csi-gc.
+//
+// It finds the CloudStack volumes created by the driver which are not
+// used by any Kubernetes persistent volume, and may delete them.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+)
+
+// Config holds the garbage collector tool configuration.
+type Config struct {
+	Agent            string
+	CloudStackConfig string
+	KubeConfig       string
+
+	// ClusterID selects the volumes which have the cluster ID tag
+	// with this value. If empty, volumes are selected by NamePrefix.
+	ClusterID  string
+	NamePrefix string
+
+	// Delete enables the deletion of orphaned volumes older than
+	// MinAge, which must then be positive. It requires ClusterID:
+	// the name prefix may match volumes of other clusters.
+	Delete bool
+	MinAge time.Duration
+}
+
+// Collector has a function Run which finds, and possibly
+// deletes, orphaned CloudStack volumes.
+type Collector interface {
+	Run(context.Context) (*Report, error)
+}
+
+// collector is Collector implementation.
+type collector struct {
+	k8sClient  kubernetes.Interface
+	connector  cloud.Interface
+	clusterID  string
+	namePrefix string
+	delete     bool
+	minAge     time.Duration
+	now        func() time.Time
+}
+
+func createK8sClient(kubeconfig, agent string) (*kubernetes.Clientset, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig == "-" {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config.UserAgent = agent
+	return kubernetes.NewForConfig(config)
+}
+
+// New creates a new Collector instance.
+func New(config Config) (Collector, error) {
+	if config.Delete && config.MinAge <= 0 {
+		return nil, errors.New("deletion requires a positive minimum age")
+	}
+	if config.Delete && config.ClusterID == "" {
+		return nil, errors.New("deletion requires a cluster ID")
+	}
+	if config.ClusterID == "" && config.NamePrefix == "" {
+		return nil, errors.New("either a cluster ID or a name prefix is required")
+	}
+	k8sClient, err := createK8sClient(config.KubeConfig, config.Agent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create Kubernetes client: %w", err)
+	}
+	csConfig, err := cloud.ReadConfig(config.CloudStackConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CloudStack configuration: %w", err)
+	}
+
+	return &collector{
+		k8sClient:  k8sClient,
+		connector:  cloud.New(csConfig),
+		clusterID:  config.ClusterID,
+		namePrefix: config.NamePrefix,
+		delete:     config.Delete,
+		minAge:     config.MinAge,
+		now:        time.Now,
+	}, nil
+}
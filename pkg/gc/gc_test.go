@@ -0,0 +1,24 @@
+package gc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{"no selector", Config{}},
+		{"delete without minimum age", Config{ClusterID: "cluster-1", Delete: true}},
+		{"delete by name prefix", Config{NamePrefix: "pvc-", Delete: true, MinAge: time.Hour}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := New(c.config); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+	"github.com/apalia/cloudstack-csi-driver/pkg/driver"
+)
+
+// listVolumesPageSize is the number of CloudStack
+// volumes listed per API call.
+const listVolumesPageSize = 500
+
+// Report is the result of a garbage collector run.
+type Report struct {
+	// DryRun is true if deletion was not enabled
+	DryRun bool `json:"dryRun"`
+	// Volumes is the number of CloudStack volumes created by the driver
+	Volumes int      `json:"volumes"`
+	Orphans []Orphan `json:"orphans"`
+}
+
+// Orphan is a CloudStack volume created by the driver
+// which no Kubernetes persistent volume refers to.
+type Orphan struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Size             int64             `json:"size"`
+	ZoneID           string            `json:"zoneId"`
+	VirtualMachineID string            `json:"virtualMachineId,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	Age              string            `json:"age"`
+
+	Deleted bool `json:"deleted"`
+	// Reason why the volume was not deleted, if deletion is enabled
+	Reason string `json:"reason,omitempty"`
+}
+
+func (c *collector) Run(ctx context.Context) (*Report, error) {
+	// List volume handles of Kubernetes persistent volumes
+
+	log.Printf("Listing persistent volumes of driver %s...", driver.DriverName)
+	pvList, err := c.k8sClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list persistent volumes: %w", err)
+	}
+	handles := make(map[string]bool)
+	for _, pv := range pvList.Items {
+		if csi := pv.Spec.CSI; csi != nil && csi.Driver == driver.DriverName {
+			handles[csi.VolumeHandle] = true
+		}
+	}
+	log.Printf("Found %v", len(handles))
+
+	// List CloudStack volumes
+
+	log.Println("Listing CloudStack volumes...")
+	volumes, err := c.listVolumes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list CloudStack volumes: %w", err)
+	}
+
+	return c.collect(ctx, volumes, handles)
+}
+
+// listVolumes lists all the CloudStack volumes, page by page.
+// Only the volumes of the cluster are listed if a cluster ID is set.
+func (c *collector) listVolumes(ctx context.Context) ([]cloud.Volume, error) {
+	var tags map[string]string
+	if c.clusterID != "" {
+		tags = map[string]string{driver.ClusterIDTagKey: c.clusterID}
+	}
+	var volumes []cloud.Volume
+	for page := 1; ; page++ {
+		list, total, err := c.connector.ListVolumes(ctx, tags, page, listVolumesPageSize)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, list...)
+		if len(list) == 0 || page*listVolumesPageSize >= total {
+			return volumes, nil
+		}
+	}
+}
+
+// collect finds the volumes created by the driver whose ID is not one
+// of the volume handles of persistent volumes, and deletes them if
+// enabled.
+func (c *collector) collect(ctx context.Context, volumes []cloud.Volume, handles map[string]bool) (*Report, error) {
+	report := &Report{
+		DryRun:  !c.delete,
+		Orphans: []Orphan{},
+	}
+	var failed int
+	for _, vol := range volumes {
+		if !c.isDriverVolume(vol) || isDeleted(vol) {
+			continue
+		}
+		report.Volumes++
+		if handles[vol.ID] {
+			continue
+		}
+		orphan := Orphan{
+			ID:               vol.ID,
+			Name:             vol.Name,
+			Size:             vol.Size,
+			ZoneID:           vol.ZoneID,
+			VirtualMachineID: vol.VirtualMachineID,
+			Tags:             vol.Tags,
+			CreatedAt:        vol.CreatedAt,
+		}
+		age := c.now().Sub(vol.CreatedAt)
+		if !vol.CreatedAt.IsZero() {
+			orphan.Age = age.Round(time.Second).String()
+		}
+		log.Printf("Volume %s (%s) is orphaned", vol.Name, vol.ID)
+		if c.delete {
+			switch {
+			case vol.VirtualMachineID != "":
+				orphan.Reason = fmt.Sprintf("attached to VM %s", vol.VirtualMachineID)
+			case vol.CreatedAt.IsZero():
+				orphan.Reason = "unknown creation date"
+			case age < c.minAge:
+				orphan.Reason = fmt.Sprintf("younger than %v", c.minAge)
+			default:
+				log.Printf("Deleting volume %s (%s)", vol.Name, vol.ID)
+				if err := c.connector.DeleteVolume(ctx, vol.ID); err != nil {
+					err = fmt.Errorf("error deleting volume %s: %w", vol.ID, err)
+					log.Println(err.Error())
+					orphan.Reason = err.Error()
+					failed++
+				} else {
+					orphan.Deleted = true
+				}
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	log.Printf("Found %v orphaned volumes out of %v", len(report.Orphans), report.Volumes)
+
+	if failed > 0 {
+		return report, fmt.Errorf("cannot delete %v orphaned volumes", failed)
+	}
+	return report, nil
+}
+
+// isDriverVolume checks whether a volume was created by the driver:
+// by its cluster ID tag if a cluster ID is given, or by its name.
+func (c *collector) isDriverVolume(vol cloud.Volume) bool {
+	if c.clusterID != "" {
+		return vol.Tags[driver.ClusterIDTagKey] == c.clusterID
+	}
+	return strings.HasPrefix(vol.Name, c.namePrefix)
+}
+
+// isDeleted checks whether a volume is already being deleted.
+func isDeleted(vol cloud.Volume) bool {
+	switch vol.State {
+	case cloud.VolumeStateDestroy, cloud.VolumeStateExpunging, cloud.VolumeStateExpunged:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package gc
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apalia/cloudstack-csi-driver/pkg/cloud"
+	"github.com/apalia/cloudstack-csi-driver/pkg/driver"
+)
+
+// volumesConnector is a fake connector with a list
+// of volumes, which records deleted volumes.
+type volumesConnector struct {
+	cloud.Interface
+	volumes []cloud.Volume
+	deleted []string
+}
+
+func (c *volumesConnector) ListVolumes(ctx context.Context, tags map[string]string, page, pageSize int) ([]cloud.Volume, int, error) {
+	var volumes []cloud.Volume
+	for _, vol := range c.volumes {
+		matching := true
+		for key, value := range tags {
+			if vol.Tags[key] != value {
+				matching = false
+			}
+		}
+		if matching {
+			volumes = append(volumes, vol)
+		}
+	}
+	start := (page - 1) * pageSize
+	if start > len(volumes) {
+		start = len(volumes)
+	}
+	end := start + pageSize
+	if end > len(volumes) {
+		end = len(volumes)
+	}
+	return volumes[start:end], len(volumes), nil
+}
+
+func (c *volumesConnector) DeleteVolume(ctx context.Context, id string) error {
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Minute)
+	clusterTags := map[string]string{driver.ClusterIDTagKey: "cluster-1"}
+
+	// Volume handles of the persistent volumes of the driver
+	handles := map[string]bool{"used": true}
+	volumes := []cloud.Volume{
+		{ID: "used", Name: "pvc-used", Tags: clusterTags, CreatedAt: old},
+		{ID: "retained", Name: "pvc-retained", Tags: clusterTags, CreatedAt: old},
+		{ID: "old", Name: "pvc-old", Tags: clusterTags, CreatedAt: old},
+		{ID: "recent", Name: "pvc-recent", Tags: clusterTags, CreatedAt: recent},
+		{ID: "attached", Name: "pvc-attached", Tags: clusterTags, CreatedAt: old, VirtualMachineID: "vm-1"},
+		{ID: "destroyed", Name: "pvc-destroyed", Tags: clusterTags, CreatedAt: old, State: cloud.VolumeStateDestroy},
+		{ID: "other-cluster", Name: "pvc-other-cluster", Tags: map[string]string{driver.ClusterIDTagKey: "cluster-2"}, CreatedAt: old},
+		{ID: "untagged", Name: "pvc-untagged", CreatedAt: old},
+		{ID: "manual", Name: "manual", CreatedAt: old},
+	}
+
+	cases := []struct {
+		name            string
+		clusterID       string
+		delete          bool
+		expectedVolumes int
+		expectedOrphans []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "dry run by cluster ID",
+			clusterID:       "cluster-1",
+			expectedVolumes: 5,
+			expectedOrphans: []string{"attached", "old", "recent", "retained"},
+		},
+		{
+			name:            "dry run by name prefix",
+			expectedVolumes: 7,
+			expectedOrphans: []string{"attached", "old", "other-cluster", "recent", "retained", "untagged"},
+		},
+		{
+			name:            "delete by cluster ID",
+			clusterID:       "cluster-1",
+			delete:          true,
+			expectedVolumes: 5,
+			expectedOrphans: []string{"attached", "old", "recent", "retained"},
+			expectedDeleted: []string{"old", "retained"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			connector := &volumesConnector{volumes: volumes}
+			gc := &collector{
+				connector:  connector,
+				clusterID:  c.clusterID,
+				namePrefix: "pvc-",
+				delete:     c.delete,
+				minAge:     time.Hour,
+				now:        func() time.Time { return now },
+			}
+			report, err := gc.collect(context.Background(), volumes, handles)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if report.DryRun == c.delete {
+				t.Errorf("Expected dry run %v", !c.delete)
+			}
+			if report.Volumes != c.expectedVolumes {
+				t.Errorf("Expected %d volumes, got %d", c.expectedVolumes, report.Volumes)
+			}
+			var orphans, deleted []string
+			for _, orphan := range report.Orphans {
+				orphans = append(orphans, orphan.ID)
+				if orphan.Deleted {
+					deleted = append(deleted, orphan.ID)
+				} else if c.delete && orphan.Reason == "" {
+					t.Errorf("Expected a reason why %s was not deleted", orphan.ID)
+				}
+			}
+			sort.Strings(orphans)
+			sort.Strings(deleted)
+			sort.Strings(connector.deleted)
+			if !equal(orphans, c.expectedOrphans) {
+				t.Errorf("Expected orphans %v, got %v", c.expectedOrphans, orphans)
+			}
+			if !equal(deleted, c.expectedDeleted) || !equal(connector.deleted, c.expectedDeleted) {
+				t.Errorf("Expected deleted %v, got %v (connector: %v)", c.expectedDeleted, deleted, connector.deleted)
+			}
+		})
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	volumes := make([]cloud.Volume, 2*listVolumesPageSize+1)
+	for i := range volumes {
+		volumes[i].ID = strconv.Itoa(i)
+		if i%2 == 0 {
+			volumes[i].Tags = map[string]string{driver.ClusterIDTagKey: "cluster-1"}
+		}
+	}
+	cases := []struct {
+		name      string
+		clusterID string
+		expected  int
+	}{
+		{"all", "", len(volumes)},
+		{"by cluster ID", "cluster-1", listVolumesPageSize + 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gc := &collector{connector: &volumesConnector{volumes: volumes}, clusterID: c.clusterID}
+			list, err := gc.listVolumes(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(list) != c.expected {
+				t.Errorf("Expected %d volumes, got %d", c.expected, len(list))
+			}
+		})
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -30,6 +30,10 @@ func (m *fakeMounter) GetDevicePath(ctx context.Context, volumeID string) (strin
 	return "/dev/sdb", nil
 }
 
+func (m *fakeMounter) LookupDevicePath(volumeID string) (string, error) {
+	return "/dev/sdb", nil
+}
+
 func (m *fakeMounter) GetDeviceName(mountPath string) (string, int, error) {
 	return mount.GetDeviceNameFromMount(m, mountPath)
 }
@@ -51,3 +55,26 @@ func (*fakeMounter) MakeDir(pathname string) error {
 func (*fakeMounter) MakeFile(pathname string) error {
 	return nil
 }
+
+func (*fakeMounter) RescanDevice(ctx context.Context, devicePath string) error {
+	return nil
+}
+
+func (*fakeMounter) ResizeFs(devicePath, deviceMountPath string) (bool, error) {
+	return true, nil
+}
+
+func (*fakeMounter) GetStatistics(volumePath string) (VolumeStatistics, error) {
+	return VolumeStatistics{
+		AvailableBytes:  3 * 1024 * 1024 * 1024,
+		TotalBytes:      10 * 1024 * 1024 * 1024,
+		UsedBytes:       7 * 1024 * 1024 * 1024,
+		AvailableInodes: 3000,
+		TotalInodes:     10000,
+		UsedInodes:      7000,
+	}, nil
+}
+
+func (*fakeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
+	return 10 * 1024 * 1024 * 1024, nil
+}
@@ -0,0 +1,32 @@
+package mount
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var operationDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "cloudstack_csi",
+		Subsystem: "mount",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of node operations on devices and file systems, by operation and status.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	},
+	[]string{"operation", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(operationDuration)
+}
+
+// observeOperation records the duration and the
+// status of an operation started at start.
+func observeOperation(operation string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	operationDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
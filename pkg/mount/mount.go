@@ -5,6 +5,7 @@ package mount
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,13 +13,15 @@ import (
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/mount-utils"
 	"k8s.io/utils/exec"
 )
 
 const (
-	diskIDPath = "/dev/disk/by-id"
+	diskIDPath   = "/dev/disk/by-id"
+	sysBlockPath = "/sys/class/block"
 )
 
 // Interface defines the set of methods to allow for
@@ -30,10 +33,21 @@ type Interface interface {
 	FormatAndMount(source string, target string, fstype string, options []string) error
 
 	GetDevicePath(ctx context.Context, volumeID string) (string, error)
+	LookupDevicePath(volumeID string) (string, error)
 	GetDeviceName(mountPath string) (string, int, error)
 	ExistsPath(filename string) (bool, error)
 	MakeDir(pathname string) error
 	MakeFile(pathname string) error
+	RescanDevice(ctx context.Context, devicePath string) error
+	ResizeFs(devicePath, deviceMountPath string) (bool, error)
+	GetStatistics(volumePath string) (VolumeStatistics, error)
+	GetBlockSizeBytes(devicePath string) (int64, error)
+}
+
+// VolumeStatistics contains usage statistics of a mounted file system.
+type VolumeStatistics struct {
+	AvailableBytes, TotalBytes, UsedBytes    int64
+	AvailableInodes, TotalInodes, UsedInodes int64
 }
 
 type mounter struct {
@@ -52,15 +66,16 @@ func New() Interface {
 	}
 }
 
-func (m *mounter) GetDevicePath(ctx context.Context, volumeID string) (string, error) {
+func (m *mounter) GetDevicePath(ctx context.Context, volumeID string) (devicePath string, err error) {
+	defer func(start time.Time) { observeOperation("get_device_path", start, err) }(time.Now())
+
 	backoff := wait.Backoff{
 		Duration: 1 * time.Second,
 		Factor:   1.1,
 		Steps:    15,
 	}
 
-	var devicePath string
-	err := wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
+	err = wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
 		path, err := m.getDevicePathBySerialID(volumeID)
 		if err != nil {
 			return false, err
@@ -81,6 +96,13 @@ func (m *mounter) GetDevicePath(ctx context.Context, volumeID string) (string, e
 	return devicePath, nil
 }
 
+// LookupDevicePath returns the device path of a volume, without
+// waiting for it to appear. It returns an empty path if the device
+// is not found.
+func (m *mounter) LookupDevicePath(volumeID string) (string, error) {
+	return m.getDevicePathBySerialID(volumeID)
+}
+
 func (m *mounter) getDevicePathBySerialID(volumeID string) (string, error) {
 	sourcePathPrefixes := []string{"virtio-", "scsi-", "scsi-0QEMU_QEMU_HARDDISK_"}
 	serial := diskUUIDToSerial(volumeID)
@@ -122,6 +144,87 @@ func (m *mounter) probeVolume(ctx context.Context) {
 	}
 }
 
+// FormatAndMount formats a device if it has no file system, and mounts it.
+func (m *mounter) FormatAndMount(source string, target string, fstype string, options []string) error {
+	start := time.Now()
+	err := m.SafeFormatAndMount.FormatAndMount(source, target, fstype, options)
+	observeOperation("format_and_mount", start, err)
+	return err
+}
+
+func (m *mounter) Mount(source string, target string, fstype string, options []string) error {
+	start := time.Now()
+	err := m.SafeFormatAndMount.Mount(source, target, fstype, options)
+	observeOperation("mount", start, err)
+	return err
+}
+
+func (m *mounter) Unmount(target string) error {
+	start := time.Now()
+	err := m.SafeFormatAndMount.Unmount(target)
+	observeOperation("unmount", start, err)
+	return err
+}
+
+// RescanDevice asks the kernel to refresh the size of a SCSI device,
+// after it has been resized. Devices which are not SCSI devices
+// (e.g. virtio-blk) are resized automatically and are ignored.
+func (m *mounter) RescanDevice(ctx context.Context, devicePath string) error {
+	log := ctxzap.Extract(ctx).Sugar()
+
+	dev, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+
+	rescanPath := filepath.Join(sysBlockPath, filepath.Base(dev), "device", "rescan")
+	if _, err := os.Stat(rescanPath); os.IsNotExist(err) {
+		log.Debugf("No rescan file %s for device %s: skipping", rescanPath, dev)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Debugf("Rescanning device %s", dev)
+	return ioutil.WriteFile(rescanPath, []byte("1"), 0200)
+}
+
+// ResizeFs grows the file system on a device to the size of
+// the device. Supported file systems are ext3, ext4, xfs and btrfs.
+func (m *mounter) ResizeFs(devicePath, deviceMountPath string) (bool, error) {
+	start := time.Now()
+	resized, err := mount.NewResizeFs(m.Exec).Resize(devicePath, deviceMountPath)
+	observeOperation("resize_fs", start, err)
+	return resized, err
+}
+
+func (*mounter) GetStatistics(volumePath string) (VolumeStatistics, error) {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(volumePath, &statfs); err != nil {
+		return VolumeStatistics{}, err
+	}
+	bsize := int64(statfs.Bsize)
+	return VolumeStatistics{
+		AvailableBytes: int64(statfs.Bavail) * bsize,
+		TotalBytes:     int64(statfs.Blocks) * bsize,
+		UsedBytes:      (int64(statfs.Blocks) - int64(statfs.Bfree)) * bsize,
+
+		AvailableInodes: int64(statfs.Ffree),
+		TotalInodes:     int64(statfs.Files),
+		UsedInodes:      int64(statfs.Files) - int64(statfs.Ffree),
+	}, nil
+}
+
+// GetBlockSizeBytes returns the size of a block device in bytes.
+func (*mounter) GetBlockSizeBytes(devicePath string) (int64, error) {
+	f, err := os.Open(devicePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Seek(0, io.SeekEnd)
+}
+
 func (m *mounter) GetDeviceName(mountPath string) (string, int, error) {
 	return mount.GetDeviceNameFromMount(m, mountPath)
 }
@@ -17,9 +17,8 @@ import (
 )
 
 var (
-	volBindingMode       = storagev1.VolumeBindingWaitForFirstConsumer
-	reclaimPolicy        = corev1.PersistentVolumeReclaimDelete
-	allowVolumeExpansion = false
+	volBindingMode = storagev1.VolumeBindingWaitForFirstConsumer
+	reclaimPolicy  = corev1.PersistentVolumeReclaimDelete
 )
 
 func (s syncer) Run(ctx context.Context) error {
@@ -93,11 +92,9 @@ func (s syncer) Run(ctx context.Context) error {
 
 func (s syncer) syncOffering(ctx context.Context, offering *cloudstack.DiskOffering) (string, error) {
 	offeringName := offering.Name
-	custom := offering.Iscustomized
-	if !custom {
-		log.Printf("Disk offering \"%s\" has a fixed size: ignoring\n", offeringName)
-		return "", nil
-	}
+
+	// Volumes of fixed-size disk offerings cannot be resized
+	allowVolumeExpansion := offering.Iscustomized
 
 	log.Printf("Syncing disk offering %s...", offeringName)
 	name, err := createStorageClassName(s.namePrefix + offeringName)
@@ -143,13 +140,21 @@ func (s syncer) syncOffering(ctx context.Context, offering *cloudstack.DiskOffer
 		return name, err
 	}
 
-	// Update labels if needed
+	// Update labels and volume expansion if needed
 
+	var update bool
 	existingLabels := labels.Set(sc.Labels)
 	if !s.labelsSet.AsSelector().Matches(existingLabels) {
 		log.Printf("Storage class %s misses labels %s: updating...", sc.Name, s.labelsSet.String())
-
 		sc.Labels = labels.Merge(existingLabels, s.labelsSet)
+		update = true
+	}
+	if sc.AllowVolumeExpansion == nil || *sc.AllowVolumeExpansion != allowVolumeExpansion {
+		log.Printf("Storage class %s has wrong AllowVolumeExpansion: updating...", sc.Name)
+		sc.AllowVolumeExpansion = &allowVolumeExpansion
+		update = true
+	}
+	if update {
 		_, err = s.k8sClient.StorageV1().StorageClasses().Update(ctx, sc, metav1.UpdateOptions{})
 		return name, err
 	}
@@ -174,9 +179,6 @@ func checkStorageClass(sc *storagev1.StorageClass, expectedOfferingID string) er
 	if sc.VolumeBindingMode == nil || *sc.VolumeBindingMode != volBindingMode {
 		errs = append(errs, errors.New("wrong VolumeBindingMode"))
 	}
-	if sc.AllowVolumeExpansion == nil || *sc.AllowVolumeExpansion != allowVolumeExpansion {
-		errs = append(errs, errors.New("wrong AllowVolumeExpansion"))
-	}
 
 	if len(errs) > 0 {
 		return combinedError(errs)
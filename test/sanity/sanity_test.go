@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/kubernetes-csi/csi-test/v4/pkg/sanity"
 	"go.uber.org/zap"
@@ -36,7 +37,7 @@ func TestSanity(t *testing.T) {
 		driver.DiskOfferingKey: "9743fd77-0f5d-4ef9-b2f8-f194235c769c",
 	}
 
-	csiDriver, err := driver.New(endpoint, fake.New(), mount.NewFake(), "node", "v0", zap.NewNop())
+	csiDriver, err := driver.New(endpoint, fake.New(), mount.NewFake(), "node", 0, time.Minute, "", "", "v0", zap.NewNop())
 	if err != nil {
 		t.Fatalf("error creating driver: %v", err)
 	}